@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"time"
+)
+
+const (
+	accessPatternSeq = iota
+	accessPatternRandom
+	accessPatternStride
+	accessPatternReverse
+	accessPatternLocality
+)
+
+var accessPatternNames = []string{"seq", "random", "stride", "reverse", "locality"}
+
+func getAccessPattern(s string) (int, error) {
+	for i, x := range accessPatternNames {
+		if x == s {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("invalid access pattern %s", s)
+}
+
+// accessIter generates n block indices out of numBlock blocks per
+// -access_pattern, n never exceeds numBlock.
+type accessIter struct {
+	numBlock int64
+	n        int64
+	i        int64
+	cur      int64
+	lane     int64
+	r        *rand.Rand
+}
+
+func newAccessIter(numBlock int64, n int64, r *rand.Rand) *accessIter {
+	assert(optAccessPattern != accessPatternSeq)
+	assert(n <= numBlock)
+	return &accessIter{
+		numBlock: numBlock,
+		n:        n,
+		cur:      -1,
+		r:        r,
+	}
+}
+
+func (this *accessIter) next() (int64, bool) {
+	if this.i >= this.n {
+		return -1, false
+	}
+	this.i++
+
+	switch optAccessPattern {
+	case accessPatternRandom:
+		this.cur = this.r.Int63n(this.numBlock)
+	case accessPatternStride:
+		// visit every -access_stride'th block, then shift by a block
+		// on wrap around, e.g. 0,2,4,1,3 for 5 blocks with stride 2
+		if this.cur < 0 {
+			this.cur = 0
+		} else if this.cur += int64(optAccessStride); this.cur >= this.numBlock {
+			this.lane++
+			this.cur = this.lane
+		}
+	case accessPatternReverse:
+		this.cur = this.numBlock - this.i
+	case accessPatternLocality:
+		// random walk within -access_locality blocks of previous block
+		if this.cur < 0 {
+			this.cur = this.r.Int63n(this.numBlock)
+		} else {
+			w := int64(optAccessLocality)
+			this.cur += this.r.Int63n(2*w+1) - w
+			this.cur %= this.numBlock
+			if this.cur < 0 {
+				this.cur += this.numBlock
+			}
+		}
+	default:
+		assert(false)
+	}
+	assert(this.cur >= 0 && this.cur < this.numBlock)
+	return this.cur, true
+}
+
+// getAccessBlockSize returns -access_block_size, or buffer size if 0.
+func getAccessBlockSize(b []byte) int64 {
+	if optAccessBlockSize == 0 {
+		return int64(len(b))
+	}
+	n := alignSize(int64(optAccessBlockSize))
+	assert(n <= int64(len(b)))
+	return n
+}
+
+// readFileByPattern reads fp by pread(2) per block at offsets by
+// -access_pattern. Offsets are chosen from the whole file, and resid bytes
+// are read, or file size if resid < 0.
+func readFileByPattern(fp *os.File, resid int64, thr *gThread) error {
+	st, err := fp.Stat()
+	if err != nil {
+		return err
+	}
+	siz := st.Size()
+	if resid < 0 || resid > siz {
+		resid = siz
+	}
+	if resid == 0 {
+		return nil
+	}
+
+	bs := getAccessBlockSize(thr.dir.readBuffer)
+	b := thr.dir.readBuffer[:bs]
+	it := newAccessIter((siz+bs-1)/bs, (resid+bs-1)/bs, thr.rand)
+	for {
+		i, ok := it.next()
+		if !ok {
+			break
+		}
+		off := i * bs
+		t := time.Now()
+		n, err := fp.ReadAt(b, off) // short read of last block returns EOF
+		thr.stat.addReadLatency(time.Since(t))
+		if err == io.EOF {
+			err = nil
+		}
+		traceOp(thr, "read", fp.Name(), off, int64(n), err, t)
+		if err != nil {
+			return getDirectError(fp.Name(), err)
+		}
+		thr.stat.incNumRead()
+		thr.stat.addNumReadBytes(n)
+	}
+	return nil
+}
+
+// writeDataByPattern extends fp to resid bytes, and writes the range by
+// pwrite(2) per block at offsets by -access_pattern. Blocks may be written
+// more than once or not at all for random patterns.
+func writeDataByPattern(fp *os.File, resid int64, thr *gThread) error {
+	assert(resid > 0)
+	t := time.Now()
+	err := fp.Truncate(resid)
+	traceOp(thr, "truncate", fp.Name(), 0, resid, err, t)
+	if err != nil {
+		return err
+	}
+
+	bs := getAccessBlockSize(thr.dir.writeBuffer)
+	numBlock := (resid + bs - 1) / bs
+	it := newAccessIter(numBlock, numBlock, thr.rand)
+	var ws writeSyncState
+	for {
+		i, ok := it.next()
+		if !ok {
+			break
+		}
+		off := i * bs
+		b := thr.dir.writeBuffer[:bs]
+		if int64(len(b)) > resid-off {
+			b = b[:resid-off]
+		}
+		fillWriteData(b, thr)
+
+		t := time.Now()
+		siz, err := fp.WriteAt(b, off)
+		traceOp(thr, "write", fp.Name(), off, int64(siz), err, t)
+		if err != nil {
+			return err
+		}
+		d := time.Since(t)
+		thr.stat.incNumWrite()
+		thr.stat.addWriteLatency(d)
+		thr.stat.addNumWriteBytes(siz)
+		if err := syncWritten(fp, off, siz, d, &ws, thr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
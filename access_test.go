@@ -0,0 +1,95 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func Test_getAccessPattern(t *testing.T) {
+	for i, s := range accessPatternNames {
+		if n, err := getAccessPattern(s); err != nil || n != i {
+			t.Error(s, n, err)
+		}
+	}
+	for _, s := range []string{"", "xxx", "Seq"} {
+		if n, err := getAccessPattern(s); err == nil {
+			t.Error(s, n)
+		}
+	}
+}
+
+func Test_accessIter(t *testing.T) {
+	pattern := optAccessPattern
+	stride := optAccessStride
+	locality := optAccessLocality
+	defer func() {
+		optAccessPattern = pattern
+		optAccessStride = stride
+		optAccessLocality = locality
+	}()
+	optAccessLocality = 2
+
+	iterList := []struct {
+		pattern  int
+		stride   uint
+		numBlock int64
+		n        int64
+		l        []int64
+	}{
+		{accessPatternReverse, 0, 5, 5, []int64{4, 3, 2, 1, 0}},
+		{accessPatternReverse, 0, 5, 2, []int64{4, 3}},
+		{accessPatternStride, 2, 5, 5, []int64{0, 2, 4, 1, 3}},
+		{accessPatternStride, 3, 7, 7, []int64{0, 3, 6, 1, 4, 2, 5}},
+		{accessPatternStride, 10, 3, 3, []int64{0, 1, 2}},
+		{accessPatternStride, 1, 4, 3, []int64{0, 1, 2}},
+	}
+	for _, x := range iterList {
+		optAccessPattern = x.pattern
+		optAccessStride = x.stride
+		it := newAccessIter(x.numBlock, x.n, nil)
+		var l []int64
+		for {
+			i, ok := it.next()
+			if !ok {
+				break
+			}
+			l = append(l, i)
+		}
+		if len(l) != len(x.l) {
+			t.Error(x, l)
+			continue
+		}
+		for i := range l {
+			if l[i] != x.l[i] {
+				t.Error(x, l)
+				break
+			}
+		}
+	}
+
+	for _, pattern := range []int{accessPatternRandom, accessPatternLocality} {
+		optAccessPattern = pattern
+		it := newAccessIter(100, 100, rand.New(rand.NewSource(1)))
+		prev := int64(-1)
+		n := 0
+		for {
+			i, ok := it.next()
+			if !ok {
+				break
+			}
+			if i < 0 || i >= 100 {
+				t.Error(pattern, i)
+			}
+			// distance from previous block including wrap around
+			if d := (i - prev + 100) % 100; pattern == accessPatternLocality &&
+				prev >= 0 && d > 2 && d < 98 {
+				t.Error(pattern, prev, i)
+			}
+			prev = i
+			n++
+		}
+		if n != 100 {
+			t.Error(pattern, n)
+		}
+	}
+}
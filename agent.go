@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	agentMsgConfig = "config"
+	agentMsgReady  = "ready"
+	agentMsgStart  = "start"
+	agentMsgStop   = "stop"
+	agentMsgResult = "result"
+	agentMsgError  = "error"
+)
+
+// agentMessage is exchanged between coordinator and agents as JSON lines.
+type agentMessage struct {
+	Type      string            `json:"type"`
+	Paths     []string          `json:"paths,omitempty"`
+	Options   map[string]string `json:"options,omitempty"`
+	StartTime *time.Time        `json:"start_time,omitempty"`
+	SeedIndex uint              `json:"seed_index,omitempty"`
+	Result    *setResult        `json:"result,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+type agentRecv struct {
+	m   agentMessage
+	err error
+}
+
+func runAgent(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	fmt.Println("Listening on", l.Addr())
+	dbg("listen", l.Addr())
+	return serveAgentListener(l, getOptions())
+}
+
+// serveAgentListener serves one coordinator at a time, each connection
+// starts from base options.
+func serveAgentListener(l net.Listener, base map[string]string) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		fmt.Println("Coordinator", conn.RemoteAddr())
+		dbg("coordinator", conn.RemoteAddr())
+		if err := serveAgent(conn, base); err != nil {
+			fmt.Println(err)
+			dbg(err)
+		}
+		conn.Close()
+	}
+}
+
+func setupAgent(m agentMessage, base map[string]string) ([]string, error) {
+	if m.Type != agentMsgConfig {
+		return nil, fmt.Errorf("unexpected message %s", m.Type)
+	}
+	if len(m.Paths) == 0 {
+		return nil, fmt.Errorf("empty paths")
+	}
+	for k := range m.Options {
+		if isProcessOption(k) {
+			return nil, fmt.Errorf("option \"%s\" not allowed", k)
+		}
+	}
+	// each connection starts from options given on command line
+	if err := setOptions(base); err != nil {
+		return nil, err
+	}
+	if err := setOptions(m.Options); err != nil {
+		return nil, err
+	}
+	return setupInput(m.Paths)
+}
+
+func serveAgent(conn net.Conn, base map[string]string) error {
+	enc := json.NewEncoder(conn)
+	dec := json.NewDecoder(conn)
+
+	var m agentMessage
+	if err := dec.Decode(&m); err != nil {
+		return err
+	}
+	input, err := setupAgent(m, base)
+	if err != nil {
+		if err := enc.Encode(agentMessage{Type: agentMsgError, Error: err.Error()}); err != nil {
+			dbg(err)
+		}
+		return err
+	}
+	dbg("input", input)
+	if err := enc.Encode(agentMessage{Type: agentMsgReady}); err != nil {
+		return err
+	}
+
+	// receive messages while running workers
+	recvCh := make(chan agentRecv)
+	doneCh := make(chan int)
+	defer close(doneCh)
+	go func() {
+		for {
+			var m agentMessage
+			err := dec.Decode(&m)
+			select {
+			case recvCh <- agentRecv{m, err}:
+			case <-doneCh:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var resultCh chan agentMessage
+	for {
+		select {
+		case r := <-recvCh:
+			if r.err != nil {
+				// stop workers if coordinator is gone
+				if resultCh != nil {
+					workerCtl.stop()
+					<-resultCh
+				}
+				if r.err == io.EOF {
+					return nil
+				}
+				return r.err
+			}
+			dbg("agent", r.m.Type)
+			switch r.m.Type {
+			case agentMsgStart:
+				if resultCh != nil {
+					return fmt.Errorf("workers already running")
+				}
+				workerCtl.reset()
+				resultCh = make(chan agentMessage, 1)
+				go func(ch chan<- agentMessage, start *time.Time, seedIndex uint) {
+					// start at the same time as other agents, stop
+					// request while waiting is pending until dispatch
+					if start != nil {
+						dbg("agent start", *start)
+						time.Sleep(time.Until(*start))
+					}
+					// seed differs among agents and sets with -seed
+					seed := initSeed(seedIndex)
+					numComplete, numInterrupted, numError, numRemain, tsv, err :=
+						dispatch(input)
+					if err != nil {
+						ch <- agentMessage{Type: agentMsgError, Error: err.Error()}
+						return
+					}
+					printSetResult(numInterrupted, numError, numRemain, tsv)
+					ch <- agentMessage{
+						Type: agentMsgResult,
+						Result: &setResult{
+							Seed:           seed,
+							NumComplete:    numComplete,
+							NumInterrupted: numInterrupted,
+							NumError:       numError,
+							NumRemain:      numRemain,
+							Stats:          tsv,
+						},
+					}
+				}(resultCh, r.m.StartTime, r.m.SeedIndex)
+			case agentMsgStop:
+				workerCtl.stop()
+			default:
+				return fmt.Errorf("unexpected message %s", r.m.Type)
+			}
+		case m := <-resultCh:
+			resultCh = nil
+			if err := enc.Encode(m); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// buildEntry emulates a compiler which looks up headers in search paths,
+// most of which miss, reads headers found by small reads, and for writers,
+// outputs an object file by writing a temporary file and renaming it.
+func buildEntry(f string, thr *gThread) error {
+	assertFilePath(f)
+	if isWriteDone(thr) {
+		return nil
+	}
+
+	// lookups of non-existent siblings
+	d := filepath.Dir(f)
+	b := filepath.Base(f)
+	for i := uint(0); i < optBuildMissingLookups; i++ {
+		x := filepath.Join(d, fmt.Sprintf("%s_missing%d_%s", getWritePathsBase(), i, b))
+		t := time.Now()
+		_, err := os.Lstat(x)
+		traceOp(thr, "stat", x, 0, 0, err, t)
+		thr.stat.incNumStat()
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	// a lookup which hits, writers also read
+	if thr.dir.readBuffer == nil {
+		thr.dir.readBuffer = newBuffer(optReadBufferSize)
+	}
+	tt := time.Now()
+	t, err := getRawFileType(f)
+	traceOp(thr, "stat", f, 0, 0, err, tt)
+	if err != nil {
+		return err
+	}
+	thr.stat.incNumStat()
+	if t != typeReg {
+		return readEntry(f, thr) // not a header
+	}
+	if !optStatOnly {
+		if resid := alignSize(optBuildReadSize.sample(thr.rand)); resid > 0 {
+			if err := readFileResid(f, resid, thr); err != nil {
+				return err
+			}
+		}
+	}
+	if thr.isReader() {
+		return nil
+	}
+
+	// output an object file after reading a translation unit
+	thr.dir.buildReads++
+	if thr.dir.buildReads%uint64(optBuildReadsPerOutput) != 0 {
+		return nil
+	}
+	return writeBuildOutput(f, thr)
+}
+
+// writeBuildOutput writes a regular file under a temporary name as other
+// write paths, and then renames it to an object file, as in compilers.
+func writeBuildOutput(f string, thr *gThread) error {
+	t := time.Now()
+	d := filepath.Dir(f)
+	tmpf, err := writeNewFile(d, f, typeReg, ".tmp", optBuildWriteSize, thr)
+	if err != nil {
+		return err
+	}
+	n := len(thr.dir.writePaths) - 1
+	assert(thr.dir.writePaths[n] == tmpf)
+
+	// rename the temporary file to the output
+	newf := strings.TrimSuffix(tmpf, ".tmp") + ".o"
+	if err := traceRename(tmpf, newf, thr); err != nil {
+		return err
+	}
+	thr.dir.writePaths[n] = newf
+	if optDirsyncWritePaths {
+		if err := traceFsyncInode(d, thr); err != nil {
+			return err
+		}
+	}
+	thr.stat.incNumOp()
+	thr.stat.addOpLatency(time.Since(t))
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_buildEntry(t *testing.T) {
+	numReader := optNumReader
+	missingLookups := optBuildMissingLookups
+	readsPerOutput := optBuildReadsPerOutput
+	readBufferSize := optReadBufferSize
+	readSize := optBuildReadSize
+	truncateWritePaths := optTruncateWritePaths
+	writeSize := optBuildWriteSize
+	defer func() {
+		optNumReader = numReader
+		optBuildMissingLookups = missingLookups
+		optBuildReadsPerOutput = readsPerOutput
+		optReadBufferSize = readBufferSize
+		optBuildReadSize = readSize
+		optTruncateWritePaths = truncateWritePaths
+		optBuildWriteSize = writeSize
+	}()
+	optNumReader = 0
+	optBuildMissingLookups = 2
+	optBuildReadsPerOutput = 3
+	optReadBufferSize = 1024
+	optBuildReadSize, _ = parseSizeDist("100")
+	optBuildWriteSize, _ = parseSizeDist("10")
+
+	d := t.TempDir()
+	var fl []string
+	for i := 0; i < 7; i++ {
+		f := filepath.Join(d, fmt.Sprint(i))
+		if err := os.WriteFile(f, make([]byte, 1000), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fl = append(fl, f)
+	}
+
+	thr := newWrite(0, 1024)
+	for _, f := range fl {
+		if err := buildEntry(f, &thr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// small reads of each path, and an output per 3 reads
+	if thr.stat.numStat != 7*3 || thr.stat.numReadBytes != 7*100 {
+		t.Error(thr.stat.numStat, thr.stat.numReadBytes)
+	}
+	if thr.stat.numOp != 2 || thr.stat.numWriteBytes != 2*10 ||
+		len(thr.dir.writePaths) != 2 {
+		t.Error(thr.stat.numOp, thr.stat.numWriteBytes, thr.dir.writePaths)
+	}
+	for _, f := range thr.dir.writePaths {
+		if !strings.HasSuffix(f, ".o") || strings.Contains(f, ".tmp") {
+			t.Error(f)
+		}
+		if info, err := os.Lstat(f); err != nil || !info.Mode().IsRegular() ||
+			info.Size() != 10 {
+			t.Error(f, info, err)
+		}
+	}
+	if l, err := filepath.Glob(filepath.Join(d, "*.tmp")); err != nil || len(l) != 0 {
+		t.Error(l, err)
+	}
+	// outputs are written as other write paths, e.g. truncated
+	optTruncateWritePaths = true
+	thr = newWrite(0, 1024)
+	for _, f := range fl[:3] {
+		if err := buildEntry(f, &thr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if thr.stat.numOp != 1 || thr.stat.numWriteBytes != 0 || len(thr.dir.writePaths) != 1 {
+		t.Error(thr.stat.numOp, thr.stat.numWriteBytes, thr.dir.writePaths)
+	} else if info, err := os.Lstat(thr.dir.writePaths[0]); err != nil || info.Size() != 10 {
+		t.Error(info, err)
+	}
+}
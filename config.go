@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// configProfile is a set of options, optionally inheriting another profile.
+type configProfile struct {
+	Inherit string                 `json:"inherit,omitempty"`
+	Paths   []string               `json:"paths,omitempty"`
+	Options map[string]interface{} `json:"options,omitempty"`
+}
+
+// configFile has top level options which are inherited by all profiles.
+type configFile struct {
+	configProfile
+	Profiles map[string]configProfile `json:"profiles,omitempty"`
+}
+
+// dumpConfig is the same format as configFile with only top level options.
+type dumpConfig struct {
+	Paths   []string          `json:"paths,omitempty"`
+	Options map[string]string `json:"options"`
+}
+
+func loadConfigFile(f string) (*configFile, error) {
+	b, err := os.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	var cf configFile
+	if err := json.Unmarshal(b, &cf); err != nil {
+		return nil, fmt.Errorf("%s: %s", f, err)
+	}
+	if len(cf.Inherit) != 0 {
+		return nil, fmt.Errorf("%s: top level can not inherit", f)
+	}
+	return &cf, nil
+}
+
+func configValueString(v interface{}) (string, error) {
+	switch x := v.(type) {
+	case string:
+		return x, nil
+	case bool:
+		return strconv.FormatBool(x), nil
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("invalid value type %T", v)
+	}
+}
+
+// resolveConfig returns options and paths of the profile, with inherited
+// profiles and then the top level applied first.
+func resolveConfig(cf *configFile, profile string) (map[string]string, []string, error) {
+	var chain []configProfile
+	visited := make(map[string]bool)
+	for name := profile; len(name) != 0; {
+		if visited[name] {
+			return nil, nil, fmt.Errorf("profile %s inherits itself", name)
+		}
+		visited[name] = true
+		p, ok := cf.Profiles[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("no such profile %s in %s",
+				name, getConfigProfiles(cf))
+		}
+		chain = append(chain, p)
+		name = p.Inherit
+	}
+	chain = append(chain, cf.configProfile)
+
+	m := make(map[string]string)
+	var paths []string
+	for i := len(chain) - 1; i >= 0; i-- {
+		for k, v := range chain[i].Options {
+			s, err := configValueString(v)
+			if err != nil {
+				return nil, nil, fmt.Errorf("option \"%s\": %s", k, err)
+			}
+			m[k] = s
+		}
+		if len(chain[i].Paths) != 0 {
+			paths = chain[i].Paths
+		}
+	}
+	return m, paths, nil
+}
+
+// applyConfig sets options from config file unless given on command line.
+func applyConfig(f string, profile string) ([]string, error) {
+	cf, err := loadConfigFile(f)
+	if err != nil {
+		return nil, err
+	}
+	m, paths, err := resolveConfig(cf, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	for k, v := range m {
+		if isProcessOption(k) {
+			return nil, fmt.Errorf("option \"%s\" not allowed in config", k)
+		}
+		if given[k] {
+			continue
+		}
+		if err := flag.Set(k, v); err != nil {
+			return nil, fmt.Errorf("option \"%s\": %s", k, err)
+		}
+	}
+	return paths, nil
+}
+
+func printConfig(paths []string) error {
+	x := dumpConfig{
+		Paths:   paths,
+		Options: make(map[string]string),
+	}
+	for k, v := range getOptions() {
+		if !isProcessOption(k) {
+			x.Options[k] = v
+		}
+	}
+	// encoding/json sorts map keys
+	b, err := json.MarshalIndent(x, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
+
+func getConfigProfiles(cf *configFile) []string {
+	var l []string
+	for k := range cf.Profiles {
+		l = append(l, k)
+	}
+	sort.Strings(l)
+	return l
+}
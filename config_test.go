@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func Test_configValueString(t *testing.T) {
+	validList := []struct {
+		v interface{}
+		s string
+	}{
+		{"", ""},
+		{"xxx", "xxx"},
+		{true, "true"},
+		{false, "false"},
+		{float64(0), "0"},
+		{float64(-1), "-1"},
+		{float64(65536), "65536"},
+	}
+	for _, x := range validList {
+		if s, err := configValueString(x.v); s != x.s || err != nil {
+			t.Error(x.v, s, err)
+		}
+	}
+
+	invalidList := []interface{}{
+		nil,
+		[]interface{}{},
+		map[string]interface{}{}}
+	for _, v := range invalidList {
+		if _, err := configValueString(v); err == nil {
+			t.Error(v)
+		}
+	}
+}
+
+func Test_resolveConfig(t *testing.T) {
+	s := `{
+		"paths": ["/path/to/xxx"],
+		"options": {"num_reader": 1, "stat_only": true},
+		"profiles": {
+			"a": {"options": {"num_reader": 2, "path_iter": "random"}},
+			"b": {"inherit": "a", "paths": ["/path/to/yyy"], "options": {"num_writer": 3}},
+			"c": {"inherit": "d"},
+			"d": {"inherit": "c"},
+			"e": {"inherit": "f"}
+		}
+	}`
+	var cf configFile
+	if err := json.Unmarshal([]byte(s), &cf); err != nil {
+		t.Error(err)
+		return
+	}
+
+	m, paths, err := resolveConfig(&cf, "")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(m) != 2 || m["num_reader"] != "1" || m["stat_only"] != "true" {
+		t.Error(m)
+	}
+	if len(paths) != 1 || paths[0] != "/path/to/xxx" {
+		t.Error(paths)
+	}
+
+	m, _, err = resolveConfig(&cf, "a")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(m) != 3 || m["num_reader"] != "2" || m["path_iter"] != "random" {
+		t.Error(m)
+	}
+
+	m, paths, err = resolveConfig(&cf, "b")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(m) != 4 || m["num_reader"] != "2" || m["num_writer"] != "3" {
+		t.Error(m)
+	}
+	if len(paths) != 1 || paths[0] != "/path/to/yyy" {
+		t.Error(paths)
+	}
+
+	for _, x := range []string{"c", "d", "e", "f"} {
+		if _, _, err := resolveConfig(&cf, x); err == nil {
+			t.Error(x)
+		}
+	}
+}
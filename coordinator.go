@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// coordinatorStartDelay is time until agents start workers after the start
+// message is sent, which needs to cover message delivery to all agents.
+const coordinatorStartDelay = 500 * time.Millisecond
+
+type coordinatorAgent struct {
+	addr string
+	conn net.Conn
+	enc  *json.Encoder
+	dec  *json.Decoder
+}
+
+func (this *coordinatorAgent) send(m agentMessage) error {
+	if err := this.enc.Encode(m); err != nil {
+		return fmt.Errorf("%s: %s", this.addr, err)
+	}
+	return nil
+}
+
+func (this *coordinatorAgent) recv(t string) (agentMessage, error) {
+	var m agentMessage
+	if err := this.dec.Decode(&m); err != nil {
+		return m, fmt.Errorf("%s: %s", this.addr, err)
+	}
+	if m.Type == agentMsgError {
+		return m, fmt.Errorf("%s: %s", this.addr, m.Error)
+	} else if m.Type != t {
+		return m, fmt.Errorf("%s: unexpected message %s", this.addr, m.Type)
+	}
+	return m, nil
+}
+
+// getCoordinatorOptions returns options explicitly given on command line,
+// which are then distributed to agents.
+func getCoordinatorOptions() map[string]string {
+	m := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		if !isProcessOption(f.Name) && f.Name != "num_set" {
+			m[f.Name] = f.Value.String()
+		}
+	})
+	return m
+}
+
+// dialCoordinatorAgents connects to agents, and closes all connections on
+// error.
+func dialCoordinatorAgents(agents []string) ([]*coordinatorAgent, error) {
+	var av []*coordinatorAgent
+	for _, addr := range agents {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			closeCoordinatorAgents(av)
+			return nil, err
+		}
+		av = append(av, &coordinatorAgent{
+			addr: addr,
+			conn: conn,
+			enc:  json.NewEncoder(conn),
+			dec:  json.NewDecoder(conn),
+		})
+		fmt.Println("Agent", addr)
+		dbg("agent", addr)
+	}
+	return av, nil
+}
+
+func closeCoordinatorAgents(av []*coordinatorAgent) {
+	for _, a := range av {
+		a.conn.Close()
+	}
+}
+
+// setupCoordinatorAgents distributes config and waits until agents are
+// ready, write paths need to be unique among agents.
+func setupCoordinatorAgents(av []*coordinatorAgent, args []string,
+	opts map[string]string) error {
+	for i, a := range av {
+		m := make(map[string]string)
+		for k, v := range opts {
+			m[k] = v
+		}
+		m["write_paths_base"] = fmt.Sprintf("%s_agent%d", optWritePathsBase, i)
+		if err := a.send(agentMessage{
+			Type:    agentMsgConfig,
+			Paths:   args,
+			Options: m,
+		}); err != nil {
+			return err
+		}
+	}
+	for _, a := range av {
+		if _, err := a.recv(agentMsgReady); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeCoordinatorResults merges results in order of agents.
+func mergeCoordinatorResults(av []*coordinatorAgent, rv []setResult) setResult {
+	var x setResult
+	for j, r := range rv {
+		if n := len(r.Stats); n > 0 {
+			fmt.Printf("#%d-#%d %s\n", len(x.Stats), len(x.Stats)+n-1, av[j].addr)
+		}
+		x.NumComplete += r.NumComplete
+		x.NumInterrupted += r.NumInterrupted
+		x.NumError += r.NumError
+		x.NumRemain += r.NumRemain
+		x.Stats = append(x.Stats, r.Stats...)
+	}
+	return x
+}
+
+func runCoordinator(agents []string, args []string) error {
+	av, err := dialCoordinatorAgents(agents)
+	if err != nil {
+		return err
+	}
+	defer closeCoordinatorAgents(av)
+	if err := setupCoordinatorAgents(av, args, getCoordinatorOptions()); err != nil {
+		return err
+	}
+
+	for i := uint(0); i < optNumSet; i++ {
+		if optNumSet != 1 {
+			fmt.Println(strings.Repeat("=", 80))
+			s := fmt.Sprintf("Set %d/%d", i+1, optNumSet)
+			fmt.Println(s)
+			dbg(s)
+		}
+		rv, err := runCoordinatorSet(av, i)
+		if err != nil {
+			return err
+		}
+
+		x := mergeCoordinatorResults(av, rv)
+		printSetResult(x.NumInterrupted, x.NumError, x.NumRemain, x.Stats)
+		if x.NumInterrupted > 0 {
+			break
+		} else if optNumSet != 1 && i != optNumSet-1 {
+			fmt.Println()
+		}
+	}
+	return nil
+}
+
+// runCoordinatorSet runs set of index set on agents, each agent uses
+// a distinct seed index per set as -num_set does.
+func runCoordinatorSet(av []*coordinatorAgent, set uint) ([]setResult, error) {
+	// agents are all ready, start them at the same wall clock time
+	start := time.Now().Add(coordinatorStartDelay)
+	for i, a := range av {
+		if err := a.send(agentMessage{
+			Type:      agentMsgStart,
+			StartTime: &start,
+			SeedIndex: set*uint(len(av)) + uint(i),
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	// forward SIGINT to agents
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT)
+	defer signal.Stop(ch)
+	doneCh := make(chan int)
+	var swg sync.WaitGroup
+	swg.Add(1)
+	go func() {
+		defer swg.Done()
+		select {
+		case <-doneCh:
+		case s := <-ch:
+			dbg("signal", s)
+			for _, a := range av {
+				if err := a.send(agentMessage{Type: agentMsgStop}); err != nil {
+					dbg(err)
+				}
+			}
+		}
+	}()
+
+	rv := make([]setResult, len(av))
+	ev := make([]error, len(av))
+	var wg sync.WaitGroup
+	for i, a := range av {
+		wg.Add(1)
+		go func(i int, a *coordinatorAgent) {
+			defer wg.Done()
+			if m, err := a.recv(agentMsgResult); err != nil {
+				ev[i] = err
+			} else if m.Result == nil {
+				ev[i] = fmt.Errorf("%s: empty result", a.addr)
+			} else {
+				rv[i] = *m.Result
+			}
+		}(i, a)
+	}
+	wg.Wait()
+	close(doneCh)
+	swg.Wait()
+
+	for _, err := range ev {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rv, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test_agentProcess is run as an agent process by Test_coordinator.
+func Test_agentProcess(t *testing.T) {
+	if os.Getenv("DIRLOAD_TEST_AGENT") == "" {
+		t.Skip("not an agent process")
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	os.Stdout.WriteString("Listening on " + l.Addr().String() + "\n")
+
+	base := getOptions()
+	for k := range base {
+		if strings.HasPrefix(k, "test.") {
+			delete(base, k) // flags of go test
+		}
+	}
+	if err := serveAgentListener(l, base); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startAgentProcess runs the test binary as an agent on localhost, and
+// returns its address.
+func startAgentProcess(t *testing.T) string {
+	cmd := exec.Command(os.Args[0], "-test.run=^Test_agentProcess$")
+	cmd.Env = append(os.Environ(), "DIRLOAD_TEST_AGENT=1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		if s := scanner.Text(); strings.HasPrefix(s, "Listening on ") {
+			go func() {
+				for scanner.Scan() {
+				}
+			}()
+			return strings.TrimPrefix(s, "Listening on ")
+		}
+	}
+	t.Fatal("agent not listening")
+	return ""
+}
+
+func Test_coordinator(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip agent processes in short mode")
+	}
+	d := t.TempDir()
+	for _, s := range []string{"a", "b", "c"} {
+		if err := os.WriteFile(filepath.Join(d, s), []byte("xxx"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	agents := []string{startAgentProcess(t), startAgentProcess(t)}
+	av, err := dialCoordinatorAgents(agents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeCoordinatorAgents(av)
+	opts := map[string]string{"num_reader": "1", "num_repeat": "2", "seed": "100"}
+	if err := setupCoordinatorAgents(av, []string{d}, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	t0 := time.Now()
+	rv, err := runCoordinatorSet(av, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// seeds differ among agents and sets
+	if len(rv) != 2 || rv[0].Seed != 102 || rv[1].Seed != 103 {
+		t.Error(rv)
+	}
+	x := mergeCoordinatorResults(av, rv)
+	if x.NumComplete != 2 || x.NumInterrupted != 0 || x.NumError != 0 ||
+		len(x.Stats) != 2 {
+		t.Fatal(x)
+	}
+	for i := range x.Stats {
+		if ts := &x.Stats[i]; ts.numRepeat != 2 || ts.numRead != 12 ||
+			ts.numReadBytes != 18 || ts.inputPath != d {
+			t.Error(i, ts)
+		}
+	}
+
+	// agents start together after the start delay
+	b0 := x.Stats[0].timeBegin
+	b1 := x.Stats[1].timeBegin
+	if b0.Sub(t0) < coordinatorStartDelay || b1.Sub(t0) < coordinatorStartDelay {
+		t.Error(t0, b0, b1)
+	}
+	if d := b0.Sub(b1); d > 100*time.Millisecond || d < -100*time.Millisecond {
+		t.Error(b0, b1)
+	}
+}
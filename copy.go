@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	copyReflink = iota
+	copyRange
+	copyReadWrite
+	numCopyMethod
+)
+
+var copyMethodNames = []string{"reflink", "copy_file_range", "rw"}
+
+func getCopyMethod(s string) (int, error) {
+	for i, x := range copyMethodNames {
+		if x == s {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("invalid copy method %s", s)
+}
+
+// copyFileImpl copies src to newly created dst by method, or methods after
+// that on unsupported errors. Returns the method which succeeded.
+func copyFileImpl(dst *os.File, src *os.File, method int, b []byte) (int, int64, error) {
+	for ; method < numCopyMethod; method++ {
+		var n int64
+		var err error
+		switch method {
+		case copyReflink:
+			if err = reflinkFile(dst, src); err == nil {
+				var st os.FileInfo
+				if st, err = dst.Stat(); err == nil {
+					n = st.Size()
+				}
+			}
+		case copyRange:
+			n, err = copyFileRange(dst, src)
+		case copyReadWrite:
+			n, err = copyReadWriteImpl(dst, src, b)
+		default:
+			assert(false)
+		}
+		// fall back only if nothing has been copied
+		if err == nil || n != 0 || !isCopyUnsupported(err) {
+			return method, n, err
+		}
+	}
+	assert(false)
+	return -1, 0, nil
+}
+
+// copyReadWriteImpl is io.Copy without using copy_file_range(2) internally.
+func copyReadWriteImpl(dst *os.File, src *os.File, b []byte) (int64, error) {
+	total := int64(0)
+	for {
+		n, err := src.Read(b)
+		if n > 0 {
+			if n, err := dst.Write(b[:n]); err != nil {
+				return total + int64(n), err
+			}
+			total += int64(n)
+		}
+		if err == io.EOF {
+			return total, nil
+		} else if err != nil {
+			return total, err
+		}
+	}
+}
+
+// copyFile creates newf as a copy of regular file oldf by -copy_method.
+func copyFile(oldf string, newf string, thr *gThread) error {
+	src, err := os.Open(oldf)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	t := time.Now()
+	dst, err := os.OpenFile(newf, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		traceRenameOp(thr, "copy", oldf, newf, 0, 0, err, t)
+		return err
+	}
+	method, n, err := copyFileImpl(dst, src, optCopyMethod, thr.dir.writeBuffer)
+	d := time.Since(t)
+	traceRenameOp(thr, "copy", oldf, newf, 0, n, err, t)
+	if err == nil {
+		err = dst.Close()
+	} else {
+		dst.Close()
+	}
+	if err != nil {
+		// not registered as a write path, don't leave a partial copy
+		if err := traceRemove(newf, thr); err != nil {
+			dbg(err)
+		}
+		return err
+	}
+	thr.stat.addNumWriteBytes(int(n))
+	thr.stat.addCopyLatency(method, d)
+	if method != optCopyMethod {
+		thr.stat.incNumCopyFallback()
+	}
+	return nil
+}
+
+func printCopyStat(tsv []threadStat) {
+	lat := make([]latencyStat, numCopyMethod)
+	numFallback := uint64(0)
+	for i := 0; i < len(tsv); i++ {
+		for j := 0; j < len(tsv[i].copyLatency) && j < len(lat); j++ {
+			lat[j].merge(&tsv[i].copyLatency[j])
+		}
+		numFallback += tsv[i].numCopyFallback
+	}
+	for i := range lat {
+		if lat[i].Count == 0 {
+			continue
+		}
+		fmt.Printf("copy %s: %d latency avg %s p50 %s p99 %s max %s\n",
+			copyMethodNames[i], lat[i].Count,
+			getLatencyString(lat[i].mean()), getLatencyString(lat[i].percentile(50)),
+			getLatencyString(lat[i].percentile(99)),
+			getLatencyString(time.Duration(lat[i].Max)))
+	}
+	if numFallback != 0 {
+		fmt.Printf("copy fallback from %s: %d\n", copyMethodNames[optCopyMethod],
+			numFallback)
+	}
+}
@@ -0,0 +1,82 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// copy_file_range(2) is missing in syscall package except for a few
+// architectures, 0 means unsupported.
+var sysCopyFileRange = map[string]uintptr{
+	"386":      377,
+	"amd64":    326,
+	"arm":      391,
+	"arm64":    285,
+	"loong64":  285,
+	"mips":     4360,
+	"mipsle":   4360,
+	"mips64":   5320,
+	"mips64le": 5320,
+	"ppc64":    379,
+	"ppc64le":  379,
+	"riscv64":  285,
+	"s390x":    375,
+}[runtime.GOARCH]
+
+// getFiclone returns FICLONE ioctl, which is _IOW(0x94, 9, int).
+func getFiclone() uintptr {
+	switch runtime.GOARCH {
+	case "mips", "mipsle", "mips64", "mips64le", "ppc64", "ppc64le":
+		return 0x80049409
+	default:
+		return 0x40049409
+	}
+}
+
+func reflinkFile(dst *os.File, src *os.File) error {
+	_, _, e := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), getFiclone(), src.Fd())
+	if e != 0 {
+		return e
+	}
+	return nil
+}
+
+// copyFileRange copies src to dst from current offsets until EOF.
+func copyFileRange(dst *os.File, src *os.File) (int64, error) {
+	if sysCopyFileRange == 0 {
+		return 0, syscall.ENOSYS
+	}
+	total := int64(0)
+	for {
+		n, _, e := syscall.Syscall6(sysCopyFileRange, src.Fd(), 0, dst.Fd(), 0,
+			1<<30, 0)
+		if e == syscall.EINTR {
+			continue
+		} else if e != 0 {
+			return total, e
+		} else if n == 0 {
+			return total, nil
+		}
+		total += int64(n)
+	}
+}
+
+// isCopyUnsupported returns true if err means the method is unavailable
+// for the files, e.g. different filesystems or lack of kernel support.
+func isCopyUnsupported(err error) bool {
+	var e syscall.Errno
+	if !errors.As(err, &e) {
+		return false
+	}
+	switch e {
+	case syscall.EOPNOTSUPP, syscall.EXDEV, syscall.EINVAL, syscall.ENOSYS,
+		syscall.ENOTTY:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+var errCopyUnsupported = errors.New("copy method unsupported")
+
+func reflinkFile(dst *os.File, src *os.File) error {
+	return errCopyUnsupported
+}
+
+func copyFileRange(dst *os.File, src *os.File) (int64, error) {
+	return 0, errCopyUnsupported
+}
+
+func isCopyUnsupported(err error) bool {
+	return errors.Is(err, errCopyUnsupported)
+}
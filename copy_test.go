@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_getCopyMethod(t *testing.T) {
+	for i, s := range copyMethodNames {
+		if n, err := getCopyMethod(s); err != nil || n != i {
+			t.Error(s, n, err)
+		}
+	}
+	if n, err := getCopyMethod("xxx"); err == nil {
+		t.Error(n)
+	}
+}
+
+func Test_copyFileImpl(t *testing.T) {
+	d := t.TempDir()
+	f := filepath.Join(d, "src")
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(data)
+	if err := os.WriteFile(f, data, 0644); err != nil {
+		t.Error(err)
+		return
+	}
+
+	for i := 0; i < numCopyMethod; i++ {
+		src, err := os.Open(f)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		newf := filepath.Join(d, copyMethodNames[i])
+		dst, err := os.Create(newf)
+		if err != nil {
+			t.Error(err)
+			src.Close()
+			return
+		}
+		method, n, err := copyFileImpl(dst, src, i, make([]byte, 4096))
+		dst.Close()
+		src.Close()
+		if err != nil || method < i || n != int64(len(data)) {
+			t.Error(i, method, n, err)
+			continue
+		}
+		if b, err := os.ReadFile(newf); err != nil || !bytes.Equal(b, data) {
+			t.Error(i, len(b), err)
+		}
+	}
+}
+
+func Test_copyFile(t *testing.T) {
+	method := optCopyMethod
+	defer func() {
+		optCopyMethod = method
+	}()
+
+	d := t.TempDir()
+	f := filepath.Join(d, "src")
+	if err := os.WriteFile(f, []byte("xxx"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	thr := newWrite(0, 4096)
+	for i := 0; i < numCopyMethod; i++ {
+		optCopyMethod = i
+		newf := filepath.Join(d, copyMethodNames[i])
+		if err := copyFile(f, newf, &thr); err != nil {
+			t.Error(i, err)
+		} else if b, err := os.ReadFile(newf); err != nil || string(b) != "xxx" {
+			t.Error(i, string(b), err)
+		}
+
+		// a failed copy doesn't leave a partial file, source being a
+		// directory fails after creating newf
+		newf += ".dir"
+		if err := copyFile(d, newf, &thr); err == nil {
+			t.Error(i, newf)
+		}
+		if exists, _ := pathExists(newf); exists {
+			t.Error(i, newf)
+		}
+	}
+}
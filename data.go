@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+const (
+	writeDataPattern = iota
+	writeDataZero
+	writeDataAscii
+	writeDataRandom
+	writeDataCompress
+	writeDataDedup
+)
+
+const dedupPoolSize = 256 // number of blocks duplicated by dedup data
+
+var (
+	writeDataNames = []string{"pattern", "zero", "ascii", "random", "compress", "dedup"}
+	dedupPool      []byte
+)
+
+func getWriteDataType(s string) (int, error) {
+	for i, x := range writeDataNames {
+		if x == s {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("invalid write data type %s", s)
+}
+
+// initWriteBuffer fills b with pattern or zeros, which is kept as is unless
+// other data types overwrite it on each write.
+func initWriteBuffer(b []byte) {
+	if optWriteData == writeDataZero {
+		return
+	}
+	pattern := []byte(optWriteDataPattern)
+	if len(pattern) == 0 {
+		pattern = []byte{0x41}
+	}
+	for i := 0; i < len(b); i += len(pattern) {
+		copy(b[i:], pattern)
+	}
+}
+
+// initDedupPool fills blocks to be duplicated by global rand, so that the
+// pool is the same among processes for the same seed.
+func initDedupPool() {
+	dedupPool = make([]byte, dedupPoolSize*optWriteDataBlockSize)
+	rand.Read(dedupPool)
+}
+
+func getDedupPoolBlock(i int) []byte {
+	n := int(optWriteDataBlockSize)
+	return dedupPool[i*n : (i+1)*n]
+}
+
+// fillWriteData fills b with write data, b is processed per
+// -write_data_block_size from the beginning for compress and dedup.
+func fillWriteData(b []byte, thr *gThread) {
+	switch optWriteData {
+	case writeDataPattern, writeDataZero:
+		return
+	case writeDataAscii:
+		i := thr.rand.Intn(len(randomWriteData) / 2)
+		copy(b, randomWriteData[i:i+len(b)])
+		return
+	}
+
+	for len(b) > 0 {
+		blk := b
+		if len(blk) > int(optWriteDataBlockSize) {
+			blk = blk[:optWriteDataBlockSize]
+		}
+		switch optWriteData {
+		case writeDataRandom:
+			thr.rand.Read(blk)
+			thr.stat.addDataBlock(len(blk), len(blk), true)
+		case writeDataCompress:
+			// random bytes followed by zeros
+			n := int(float64(len(blk)) / optWriteDataCompressRatio)
+			thr.rand.Read(blk[:n])
+			for i := n; i < len(blk); i++ {
+				blk[i] = 0
+			}
+			thr.stat.addDataBlock(len(blk), n, true)
+		case writeDataDedup:
+			// unique random block, or a block in the pool
+			if thr.rand.Float64() < 1/optWriteDataDedupRatio {
+				thr.rand.Read(blk)
+				thr.stat.addDataBlock(len(blk), len(blk), true)
+			} else {
+				copy(blk, getDedupPoolBlock(thr.rand.Intn(dedupPoolSize)))
+				thr.stat.addDataBlock(len(blk), len(blk), false)
+			}
+		default:
+			assert(false)
+		}
+		b = b[len(blk):]
+	}
+}
+
+// getDataRatio returns effective compress and dedup ratios of write data.
+// Duplicated blocks are assumed to cover the pool once they outnumber it.
+func getDataRatio(tsv []threadStat) (float64, float64) {
+	var numBytes, numIncompBytes, numBlock, numUniqueBlock uint64
+	for i := range tsv {
+		numBytes += tsv[i].numDataBytes
+		numIncompBytes += tsv[i].numDataIncompBytes
+		numBlock += tsv[i].numDataBlock
+		numUniqueBlock += tsv[i].numDataUniqueBlock
+	}
+	if numIncompBytes == 0 || numBlock == 0 {
+		return 0, 0
+	}
+	numPoolBlock := numBlock - numUniqueBlock
+	if numPoolBlock > dedupPoolSize {
+		numPoolBlock = dedupPoolSize
+	}
+	return float64(numBytes) / float64(numIncompBytes),
+		float64(numBlock) / float64(numUniqueBlock+numPoolBlock)
+}
+
+func printDataStat(tsv []threadStat) {
+	switch optWriteData {
+	case writeDataRandom, writeDataCompress, writeDataDedup:
+	default:
+		return
+	}
+	compress, dedup := getDataRatio(tsv)
+	if compress == 0 {
+		return
+	}
+	fmt.Printf("Write data %s compress ratio %.2f", writeDataNames[optWriteData], compress)
+	if optWriteData == writeDataCompress {
+		fmt.Printf(" (target %.2f)", optWriteDataCompressRatio)
+	}
+	fmt.Printf(" dedup ratio %.2f", dedup)
+	if optWriteData == writeDataDedup {
+		fmt.Printf(" (target %.2f)", optWriteDataDedupRatio)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_getWriteDataType(t *testing.T) {
+	for i, s := range writeDataNames {
+		if x, err := getWriteDataType(s); err != nil || x != i {
+			t.Error(s, x, err)
+		}
+	}
+	for _, s := range []string{"", "xxx", "Zero"} {
+		if x, err := getWriteDataType(s); err == nil {
+			t.Error(s, x)
+		}
+	}
+}
+
+func Test_fillWriteData(t *testing.T) {
+	writeData := optWriteData
+	compressRatio := optWriteDataCompressRatio
+	dedupRatio := optWriteDataDedupRatio
+	blockSize := optWriteDataBlockSize
+	defer func() {
+		optWriteData = writeData
+		optWriteDataCompressRatio = compressRatio
+		optWriteDataDedupRatio = dedupRatio
+		optWriteDataBlockSize = blockSize
+	}()
+	optWriteDataCompressRatio = 4
+	optWriteDataDedupRatio = 2
+	optWriteDataBlockSize = 1024
+
+	dataList := []struct {
+		typ      int
+		compress float64
+		dedup    float64
+	}{
+		{writeDataRandom, 1, 1},
+		{writeDataCompress, 4, 1},
+		{writeDataDedup, 1, 2},
+	}
+	for _, x := range dataList {
+		optWriteData = x.typ
+		initDir()
+		thr := newWrite(0, 1<<16)
+		for i := 0; i < 1000; i++ {
+			fillWriteData(thr.dir.writeBuffer[:1<<16-i], &thr)
+		}
+		compress, dedup := getDataRatio([]threadStat{thr.stat})
+		if compress < x.compress*0.99 || compress > x.compress*1.01 {
+			t.Error(x.typ, compress)
+		}
+		if dedup < x.dedup*0.95 || dedup > x.dedup*1.05 {
+			t.Error(x.typ, dedup)
+		}
+	}
+}
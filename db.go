@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// dbState is per writer state of db personality.
+// Each commit appends pages to WAL with fdatasync(2), then overwrites
+// the same pages in the data file in place. Checkpoint fsync(2)s the
+// data file and truncates WAL.
+type dbState struct {
+	data      *os.File
+	wal       *os.File
+	numPage   int64
+	numCommit uint64
+}
+
+func initDb(thr *gThread) (*dbState, error) {
+	// database is under input path with a write path name
+	root, err := creatNamedWritePath(thr.stat.inputPath, "db", thr,
+		func(f string) error {
+			return traceMkdir(f, 0755, thr)
+		})
+	if err != nil {
+		return nil, err
+	}
+	thr.dir.writePaths = append(thr.dir.writePaths, root)
+
+	this := &dbState{
+		numPage: optDbDataSize / int64(optDbPageSize),
+	}
+	assert(this.numPage > 0)
+
+	// preallocate the data file
+	f := filepath.Join(root, "data")
+	t := time.Now()
+	fp, err := os.OpenFile(f, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	traceOp(thr, "create", f, 0, 0, err, t)
+	if err != nil {
+		return nil, err
+	}
+	thr.dir.writePaths = append(thr.dir.writePaths, f)
+	this.data = fp
+	if err := writeData(fp, this.numPage*int64(optDbPageSize), thr); err != nil {
+		this.close()
+		return nil, err
+	}
+	if err := traceSync(fp, thr); err != nil {
+		this.close()
+		return nil, err
+	}
+
+	f = filepath.Join(root, "wal")
+	t = time.Now()
+	fp, err = os.OpenFile(f, os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0600)
+	traceOp(thr, "create", f, 0, 0, err, t)
+	if err != nil {
+		this.close()
+		return nil, err
+	}
+	thr.dir.writePaths = append(thr.dir.writePaths, f)
+	this.wal = fp
+	if optDirsyncWritePaths {
+		if err := traceFsyncInode(root, thr); err != nil {
+			this.close()
+			return nil, err
+		}
+	}
+	return this, nil
+}
+
+func (this *dbState) close() {
+	if this.data != nil {
+		this.data.Close()
+		this.data = nil
+	}
+	if this.wal != nil {
+		this.wal.Close()
+		this.wal = nil
+	}
+}
+
+func dbEntry(f string, thr *gThread) error {
+	// readers are not part of database commits
+	if thr.isReader() {
+		return readEntry(f, thr)
+	}
+	if isWriteDone(thr) {
+		return nil
+	}
+	if thr.dir.db == nil {
+		if x, err := initDb(thr); err != nil {
+			return err
+		} else {
+			thr.dir.db = x
+		}
+	}
+	return commitDb(thr.dir.db, thr)
+}
+
+func commitDb(this *dbState, thr *gThread) error {
+	siz := int(optDbPageSize)
+	pages := make([]int64, optDbPagesPerCommit)
+	for i := range pages {
+		pages[i] = thr.rand.Int63n(this.numPage)
+	}
+
+	// append pages to WAL and fdatasync(2)
+	t := time.Now()
+	if err := writeData(this.wal, int64(siz*len(pages)), thr); err != nil {
+		return err
+	}
+	if err := traceFdatasync(this.wal, thr); err != nil {
+		return err
+	}
+	thr.stat.incNumOp()
+	thr.stat.addOpLatency(time.Since(t))
+	this.numCommit++
+
+	// overwrite pages in the data file in place
+	for _, n := range pages {
+		if err := writeDataAt(this.data, n*int64(siz), int64(siz), thr); err != nil {
+			return err
+		}
+	}
+
+	// checkpoint makes the data file durable, then WAL can be discarded
+	if optDbCheckpointInterval > 0 && this.numCommit%uint64(optDbCheckpointInterval) == 0 {
+		if err := traceSync(this.data, thr); err != nil {
+			return err
+		}
+		tt := time.Now()
+		err := this.wal.Truncate(0)
+		traceOp(thr, "truncate", this.wal.Name(), 0, 0, err, tt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dbFinish(thr *gThread) error {
+	if x := thr.dir.db; x != nil {
+		x.close()
+	}
+	return nil
+}
@@ -23,19 +23,30 @@ type threadDir struct {
 	writeBuffer       []byte
 	writePaths        []string
 	writePathsCounter uint64
+	maildir           *maildirState
+	db                *dbState
+	web               *webState
+	buildReads        uint64
+	log               *logState
+	syncFile          *os.File // opened with -sync_open
+}
+
+func newBuffer(bufsiz uint) []byte {
+	if optDirect {
+		return alignBuffer(uint(alignSize(int64(bufsiz))), directAlignment)
+	}
+	return make([]byte, bufsiz)
 }
 
 func newReadDir(bufsiz uint) threadDir {
 	return threadDir{
-		readBuffer: make([]byte, bufsiz),
+		readBuffer: newBuffer(bufsiz),
 	}
 }
 
 func newWriteDir(bufsiz uint) threadDir {
-	b := make([]byte, bufsiz)
-	for i := 0; i < len(b); i++ {
-		b[i] = 0x41
-	}
+	b := newBuffer(bufsiz)
+	initWriteBuffer(b)
 	return threadDir{
 		writeBuffer: b,
 	}
@@ -43,37 +54,45 @@ func newWriteDir(bufsiz uint) threadDir {
 
 var (
 	randomWriteData []byte
-	writePathsTs    string
+	writePathsTag   string   // timestamp, or seed if -seed is given
+	keptWritePaths  []string // write paths left by the last dispatch
 )
 
-func initDir(random bool) {
-	if random {
+func initDir() {
+	switch optWriteData {
+	case writeDataAscii:
 		assert(maxBufferSize > 0)
 		randomWriteData = make([]byte, maxBufferSize*2) // doubled
 		for i := 0; i < len(randomWriteData); i++ {
 			randomWriteData[i] = byte(rand.Intn(127-32) + 32)
 		}
+	case writeDataDedup:
+		initDedupPool()
+	}
+	initExtent()
+	// write path names are reproducible with -seed, paths left by previous
+	// runs of the same seed are skipped on creation
+	if optSeed != 0 {
+		writePathsTag = fmt.Sprintf("seed%d", workerSeed)
+	} else {
+		writePathsTag = time.Now().Format("20060102150405")
 	}
-	writePathsTs = time.Now().Format("20060102150405")
 }
 
-func cleanupWritePaths(tdv []*threadDir, keepWritePaths bool) (int, error) {
+func getWritePaths(tdv []*threadDir) []string {
 	var l []string
 	for i := 0; i < len(tdv); i++ {
 		l = append(l, tdv[i].writePaths...)
 	}
+	return l
+}
 
-	numRemain := 0
+func cleanupWritePaths(tdv []*threadDir, keepWritePaths bool) ([]string, error) {
+	l := getWritePaths(tdv)
 	if keepWritePaths {
-		numRemain += len(l)
-	} else {
-		if l, err := unlinkWritePaths(l, -1); err != nil {
-			return -1, err
-		} else {
-			numRemain += len(l)
-		}
+		return l, nil
 	}
-	return numRemain, nil
+	return unlinkWritePaths(l, -1)
 }
 
 func unlinkWritePaths(l []string, count int) ([]string, error) {
@@ -119,7 +138,9 @@ func assertFilePath(f string) {
 
 func readEntry(f string, thr *gThread) error {
 	assertFilePath(f)
+	tt := time.Now()
 	t, err := getRawFileType(f)
+	traceOp(thr, "stat", f, 0, 0, err, tt)
 	if err != nil {
 		return err
 	}
@@ -145,7 +166,9 @@ func readEntry(f string, thr *gThread) error {
 	var x string
 	switch t {
 	case typeSymlink:
+		tt := time.Now()
 		x, err = os.Readlink(f)
+		traceOp(thr, "readlink", f, 0, int64(len(x)), err, tt)
 		if err != nil {
 			return err
 		}
@@ -154,7 +177,9 @@ func readEntry(f string, thr *gThread) error {
 			x = filepath.Join(filepath.Dir(f), x)
 			assert(filepath.IsAbs(x))
 		}
+		tt = time.Now()
 		t, err = getFileType(x) // update type
+		traceOp(thr, "stat", x, 0, 0, err, tt)
 		if err != nil {
 			return err
 		}
@@ -190,43 +215,63 @@ func readEntry(f string, thr *gThread) error {
 }
 
 func readFile(f string, thr *gThread) error {
-	fp, err := os.Open(f)
+	resid := int64(-1) // negative resid means read until EOF
+	if optReadSize != nil {
+		resid = alignSize(optReadSize.sample(thr.rand))
+		if resid == 0 {
+			return nil
+		}
+	}
+	return readFileResid(f, resid, thr)
+}
+
+// readFileResid reads resid bytes of f, or until EOF if resid < 0.
+func readFileResid(f string, resid int64, thr *gThread) error {
+	assert(resid == -1 || resid > 0)
+	fp, err := traceOpenFile(f, os.O_RDONLY, 0, thr)
 	if err != nil {
 		return err
 	}
-	defer fp.Close()
+	defer traceClose(fp, thr)
 
 	b := thr.dir.readBuffer
-	resid := optReadSize // negative resid means read until EOF
-	if resid == 0 {
-		resid = rand.Intn(len(b)) + 1
-		assert(resid > 0)
-		assert(resid <= len(b))
+	if optAccessMethod == accessMmap {
+		return readFileMmap(fp, resid, thr)
+	} else if optAccessPattern != accessPatternSeq {
+		return readFileByPattern(fp, resid, thr)
 	}
-	assert(resid == -1 || resid > 0)
 
+	off := int64(0)
 	for {
 		// cut slice size if > positive residual
 		if resid > 0 {
-			if len(b) > resid {
+			if int64(len(b)) > resid {
 				b = b[:resid]
 			}
 		}
 
+		t := time.Now()
 		siz, err := fp.Read(b)
+		thr.stat.addReadLatency(time.Since(t))
+		if err == io.EOF {
+			traceOp(thr, "read", f, off, int64(siz), nil, t)
+		} else {
+			traceOp(thr, "read", f, off, int64(siz), err, t)
+		}
+		off += int64(siz)
 		if err == io.EOF {
 			thr.stat.incNumRead()
 			thr.stat.addNumReadBytes(siz)
 			break
 		} else if err != nil {
-			return err
+			return getDirectError(f, err)
 		}
 		thr.stat.incNumRead()
 		thr.stat.addNumReadBytes(siz)
 
 		// end if positive residual becomes <= 0
 		if resid > 0 {
-			resid -= siz
+			resid -= int64(siz)
 			if resid <= 0 {
 				if optDebug {
 					assert(resid == 0)
@@ -241,7 +286,9 @@ func readFile(f string, thr *gThread) error {
 
 func writeEntry(f string, thr *gThread) error {
 	assertFilePath(f)
+	tt := time.Now()
 	t, err := getRawFileType(f)
+	traceOp(thr, "stat", f, 0, 0, err, tt)
 	if err != nil {
 		return err
 	}
@@ -285,30 +332,70 @@ func writeEntry(f string, thr *gThread) error {
 	return nil
 }
 
+// getNextWritePath constructs a write path under d, which may exist if
+// left by previous sets.
+func getNextWritePath(d string, thr *gThread) string {
+	newb := fmt.Sprintf("%s_gid%d_%s_%d",
+		getWritePathsBase(), thr.gid, writePathsTag, thr.dir.writePathsCounter)
+	thr.dir.writePathsCounter++
+	return filepath.Join(d, newb)
+}
+
+// creatNamedWritePath creates a write path with name under d by creat, and
+// retries with a counter appended if it exists, e.g. left by a previous run
+// of the same seed.
+func creatNamedWritePath(d string, name string, thr *gThread,
+	creat func(string) error) (string, error) {
+	b := fmt.Sprintf("%s_gid%d_%s_%s", getWritePathsBase(), thr.gid, writePathsTag, name)
+	for i := 0; ; i++ {
+		f := filepath.Join(d, b)
+		if i > 0 {
+			f = fmt.Sprintf("%s.%d", f, i)
+		}
+		if err := creat(f); err == nil {
+			return f, nil
+		} else if !os.IsExist(err) {
+			return "", err
+		}
+	}
+}
+
 func writeFile(d string, f string, thr *gThread) error {
 	if isWriteDone(thr) {
 		return nil
 	}
+	t := optWritePathsType[thr.rand.Intn(len(optWritePathsType))]
+	_, err := writeNewFile(d, f, t, "", optWriteSize, thr)
+	return err
+}
 
-	// construct a write path
-	newb := fmt.Sprintf("%s_gid%d_%s_%d",
-		getWritePathsBase(), thr.gid, writePathsTs, thr.dir.writePathsCounter)
-	thr.dir.writePathsCounter++
-	newf := filepath.Join(d, newb)
-
-	// create an inode
-	t := optWritePathsType[rand.Intn(len(optWritePathsType))]
-	if err := creatInode(f, newf, t); err != nil {
-		return err
+// writeNewFile creates a write path of type t with suffix under d, which is
+// registered as the last write path and returned. A regular file is then
+// written by size sampled from sd.
+func writeNewFile(d string, f string, t fileType, suffix string, sd *sizeDist,
+	thr *gThread) (string, error) {
+	// create an inode, skip write paths left by previous sets
+	var newf string
+	var dc time.Duration
+	for {
+		newf = getNextWritePath(d, thr) + suffix
+		tc := time.Now()
+		err := creatInode(f, newf, t, thr)
+		dc = time.Since(tc)
+		if err == nil {
+			break
+		} else if !os.IsExist(err) {
+			return "", err
+		}
 	}
 	if optFsyncWritePaths {
-		if err := fsyncInode(newf); err != nil {
-			return err
+		if err := traceFsyncInode(newf, thr); err != nil {
+			return "", err
 		}
 	}
 	if optDirsyncWritePaths {
-		if err := fsyncInode(d); err != nil {
-			return err
+		if err := traceFsyncInode(d, thr); err != nil {
+			return "", err
 		}
 	}
 
@@ -316,95 +403,172 @@ func writeFile(d string, f string, thr *gThread) error {
 	thr.dir.writePaths = append(thr.dir.writePaths, newf)
 	if t != typeReg {
 		thr.stat.incNumWrite()
-		return nil
+		thr.stat.addWriteLatency(dc)
+		return newf, nil
 	}
+	return newf, writeRegFile(newf, dc, sd, thr)
+}
+
+// writeRegFile writes a newly created regular file newf, dc is latency of
+// the creation.
+func writeRegFile(newf string, dc time.Duration, sd *sizeDist, thr *gThread) error {
 
 	// open the write path and start writing
-	fp, err := os.OpenFile(newf, os.O_APPEND|os.O_WRONLY, 0644)
+	flag := os.O_APPEND | os.O_WRONLY
+	if optAccessMethod == accessMmap {
+		flag = os.O_RDWR // shared mapping requires read
+	} else if optAccessPattern != accessPatternSeq || optExtentOps != nil {
+		flag = os.O_WRONLY // pwrite(2) ignores offset with O_APPEND
+	}
+	fp, err := traceOpenFile(newf, flag|getSyncOpenFlag(), 0644, thr)
 	if err != nil {
 		return err
 	}
-	defer fp.Close()
+	defer traceClose(fp, thr)
+	if optSyncOpen != syncOpenNone {
+		thr.dir.syncFile = fp
+		defer func() {
+			thr.dir.syncFile = nil
+		}()
+	}
 
-	b := thr.dir.writeBuffer
-	resid := optWriteSize // negative resid means no write
-	if resid < 0 {
+	resid := int64(-1) // non-positive resid means no write
+	if sd != nil {
+		resid = alignSize(sd.sample(thr.rand))
+	}
+	if resid <= 0 {
 		thr.stat.incNumWrite()
+		thr.stat.addWriteLatency(dc)
+		if optExtentOps != nil {
+			return runExtentOps(fp, thr)
+		}
 		return nil
-	} else if resid == 0 {
-		resid = rand.Intn(len(b)) + 1
-		assert(resid > 0)
-		assert(resid <= len(b))
 	}
-	assert(resid > 0)
 
 	if optTruncateWritePaths {
-		if err := fp.Truncate(int64(resid)); err != nil {
+		t := time.Now()
+		err := fp.Truncate(resid)
+		traceOp(thr, "truncate", newf, 0, resid, err, t)
+		if err != nil {
 			return err
 		}
 		thr.stat.incNumWrite()
+		thr.stat.addWriteLatency(time.Since(t))
+	} else if optAccessMethod == accessMmap {
+		if err := writeDataMmap(fp, resid, thr); err != nil {
+			return err
+		}
+	} else if optAccessPattern != accessPatternSeq {
+		if err := writeDataByPattern(fp, resid, thr); err != nil {
+			return getDirectError(newf, err)
+		}
 	} else {
-		for {
-			// cut slice size if > residual
-			if len(b) > resid {
-				b = b[:resid]
-			}
-			if optRandomWriteData {
-				i := rand.Intn(len(randomWriteData) / 2)
-				copy(b, randomWriteData[i:i+len(b)])
-			}
-
-			siz, err := fp.Write(b)
-			if err != nil {
-				return err
-			}
-			thr.stat.incNumWrite()
-			thr.stat.addNumWriteBytes(siz)
-
-			// end if residual becomes <= 0
-			resid -= siz
-			if resid <= 0 {
-				if optDebug {
-					assert(resid == 0)
-				}
-				break
-			}
+		if err := writeData(fp, resid, thr); err != nil {
+			return getDirectError(newf, err)
 		}
 	}
 
+	if optExtentOps != nil {
+		if err := runExtentOps(fp, thr); err != nil {
+			return err
+		}
+	}
 	if optFsyncWritePaths {
-		if err := fp.Sync(); err != nil {
+		if err := traceFlush(fp, thr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeData writes resid bytes to fp using the thread's write buffer.
+func writeData(fp *os.File, resid int64, thr *gThread) error {
+	return writeDataAt(fp, -1, resid, thr)
+}
+
+// writeDataAt is writeData at offset off, or current offset if off < 0.
+func writeDataAt(fp *os.File, off int64, resid int64, thr *gThread) error {
+	assert(resid > 0)
+	b := thr.dir.writeBuffer
+	var ws writeSyncState
+	for {
+		// cut slice size if > residual
+		if int64(len(b)) > resid {
+			b = b[:resid]
+		}
+		fillWriteData(b, thr)
+
+		t := time.Now()
+		start := off
+		var siz int
+		var err error
+		if off < 0 {
+			siz, err = fp.Write(b)
+			traceOp(thr, "write", fp.Name(), -1, int64(siz), err, t)
+		} else {
+			siz, err = fp.WriteAt(b, off)
+			traceOp(thr, "write", fp.Name(), off, int64(siz), err, t)
+			off += int64(siz)
+		}
+		if err != nil {
 			return err
 		}
+		d := time.Since(t)
+		thr.stat.incNumWrite()
+		thr.stat.addWriteLatency(d)
+		thr.stat.addNumWriteBytes(siz)
+		if err := syncWritten(fp, start, siz, d, &ws, thr); err != nil {
+			return err
+		}
+
+		// end if residual becomes <= 0
+		resid -= int64(siz)
+		if resid <= 0 {
+			if optDebug {
+				assert(resid == 0)
+			}
+			break
+		}
 	}
 	return nil
 }
 
-func creatInode(oldf string, newf string, t fileType) error {
+func creatInode(oldf string, newf string, t fileType, thr *gThread) error {
 	if t == typeLink {
 		if t, err := getRawFileType(oldf); err != nil {
 			return err
 		} else if t == typeReg {
-			if err := os.Link(oldf, newf); err != nil {
-				return err
-			}
-			return nil
+			tt := time.Now()
+			err := os.Link(oldf, newf)
+			traceRenameOp(thr, "link", oldf, newf, 0, 0, err, tt)
+			return err
+		}
+		t = typeDir // create a directory instead
+	} else if t == typeCopy {
+		if t, err := getRawFileType(oldf); err != nil {
+			return err
+		} else if t == typeReg {
+			return copyFile(oldf, newf, thr)
 		}
 		t = typeDir // create a directory instead
 	}
 
+	tt := time.Now()
 	if t == typeDir {
-		if err := os.Mkdir(newf, 0644); err != nil {
+		if err := traceMkdir(newf, 0644, thr); err != nil {
 			return err
 		}
 	} else if t == typeReg {
-		if fp, err := os.Create(newf); err != nil {
+		fp, err := os.OpenFile(newf, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		traceOp(thr, "create", newf, 0, 0, err, tt)
+		if err != nil {
 			return err
-		} else {
-			defer fp.Close()
 		}
+		defer fp.Close()
 	} else if t == typeSymlink {
-		if err := os.Symlink(oldf, newf); err != nil {
+		err := os.Symlink(oldf, newf)
+		traceRenameOp(thr, "symlink", oldf, newf, 0, 0, err, tt)
+		if err != nil {
 			return err
 		}
 	}
@@ -423,9 +587,82 @@ func fsyncInode(f string) error {
 	return nil
 }
 
+// traceFsyncInode is fsyncInode recorded to trace file.
+func traceFsyncInode(f string, thr *gThread) error {
+	t := time.Now()
+	err := fsyncInode(f)
+	traceOp(thr, "fsync", f, 0, 0, err, t)
+	return err
+}
+
+// traceOpenFile is openFile recorded to trace file.
+func traceOpenFile(f string, flag int, perm os.FileMode, thr *gThread) (*os.File, error) {
+	t := time.Now()
+	fp, err := openFile(f, flag, perm)
+	traceOp(thr, "open", f, 0, 0, err, t)
+	return fp, err
+}
+
+// traceClose is fp.Close recorded to trace file.
+func traceClose(fp *os.File, thr *gThread) error {
+	t := time.Now()
+	err := fp.Close()
+	traceOp(thr, "close", fp.Name(), 0, 0, err, t)
+	return err
+}
+
+// traceMkdir is os.Mkdir recorded to trace file.
+func traceMkdir(f string, perm os.FileMode, thr *gThread) error {
+	t := time.Now()
+	err := os.Mkdir(f, perm)
+	traceOp(thr, "mkdir", f, 0, 0, err, t)
+	return err
+}
+
+// traceRename is os.Rename recorded to trace file.
+func traceRename(oldf string, newf string, thr *gThread) error {
+	t := time.Now()
+	err := os.Rename(oldf, newf)
+	traceRenameOp(thr, "rename", oldf, newf, 0, 0, err, t)
+	return err
+}
+
+// traceRemove is os.Remove recorded to trace file.
+func traceRemove(f string, thr *gThread) error {
+	t := time.Now()
+	err := os.Remove(f)
+	traceOp(thr, "unlink", f, 0, 0, err, t)
+	return err
+}
+
+// traceSync is fp.Sync recorded to trace file.
+func traceSync(fp *os.File, thr *gThread) error {
+	t := time.Now()
+	err := fp.Sync()
+	traceOp(thr, "fsync", fp.Name(), 0, 0, err, t)
+	if err == nil {
+		thr.stat.addFlushLatency(flushFsync, time.Since(t))
+	}
+	return err
+}
+
+// traceFdatasync is fdatasync recorded to trace file.
+func traceFdatasync(fp *os.File, thr *gThread) error {
+	t := time.Now()
+	err := fdatasync(fp)
+	traceOp(thr, "fdatasync", fp.Name(), 0, 0, err, t)
+	if err == nil {
+		thr.stat.addFlushLatency(flushFdatasync, time.Since(t))
+	}
+	return err
+}
+
 func isWriteDone(thr *gThread) bool {
 	if !thr.isWriter() || optNumWritePaths <= 0 {
 		return false
+	} else if optPersonality != nil {
+		// personality counts operations instead
+		return thr.stat.numOp >= uint64(optNumWritePaths)
 	} else {
 		return len(thr.dir.writePaths) >= optNumWritePaths
 	}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_getNextWritePath(t *testing.T) {
+	defer func() {
+		optSeed = 0
+	}()
+
+	// the same seed gives the same names
+	var l [2][]string
+	for i := range l {
+		optSeed = 12345
+		initSeed(1)
+		initDir()
+		thr := newWrite(3, 1024)
+		for j := 0; j < 2; j++ {
+			l[i] = append(l[i], getNextWritePath("/x", &thr))
+		}
+	}
+	b := getWritePathsBase()
+	for i := range l {
+		if len(l[i]) != 2 || l[i][0] != "/x/"+b+"_gid3_seed12346_0" ||
+			l[i][1] != "/x/"+b+"_gid3_seed12346_1" {
+			t.Error(l[i])
+		}
+	}
+
+	optSeed = 0
+	initSeed(1)
+	initDir()
+	thr := newWrite(3, 1024)
+	if f := getNextWritePath("/x", &thr); f == l[0][0] {
+		t.Error(f)
+	}
+}
+
+func Test_creatNamedWritePath(t *testing.T) {
+	defer func() {
+		optSeed = 0
+	}()
+	optSeed = 12345
+	initSeed(0)
+	initDir()
+
+	// paths left by a previous run of the same seed are skipped
+	d := t.TempDir()
+	thr := newWrite(0, 1024)
+	mkdir := func(f string) error {
+		return os.Mkdir(f, 0755)
+	}
+	f := filepath.Join(d, getWritePathsBase()+"_gid0_seed12345_db")
+	for _, x := range []string{f, f + ".1", f + ".2"} {
+		if newf, err := creatNamedWritePath(d, "db", &thr, mkdir); err != nil || newf != x {
+			t.Error(x, newf, err)
+		}
+	}
+
+	if _, err := creatNamedWritePath(filepath.Join(d, "xxx"), "db", &thr, mkdir); err == nil {
+		t.Error(d)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// alignBuffer returns siz bytes slice whose address is aligned to align.
+func alignBuffer(siz uint, align uint) []byte {
+	assert(align > 0 && align&(align-1) == 0)
+	b := make([]byte, siz+align)
+	off := uint(0)
+	if r := uint(uintptr(unsafe.Pointer(&b[0]))) & (align - 1); r != 0 {
+		off = align - r
+	}
+	return b[off : off+siz : off+siz]
+}
+
+// directAlignment is -direct_alignment, or block size of filesystems of
+// input paths set by initDirect if -direct_alignment is 0.
+var directAlignment uint
+
+// initDirect queries block size of filesystems of input paths for -direct
+// unless -direct_alignment is specified, the largest one is used.
+func initDirect(input []string) error {
+	if !optDirect || optDirectAlignment != 0 {
+		return nil
+	}
+	align := uint(0)
+	for _, f := range input {
+		n, err := getBlockSize(f)
+		if err != nil {
+			return err
+		}
+		if n == 0 || n&(n-1) != 0 || n > maxBufferSize {
+			return fmt.Errorf("%s: unsupported block size %d, specify -direct_alignment", f, n)
+		}
+		if n > align {
+			align = n
+		}
+	}
+	directAlignment = align
+	dbg("direct alignment", directAlignment)
+	return nil
+}
+
+// alignSize rounds siz up to a multiple of direct alignment if -direct,
+// or returns siz as is if the alignment is not yet known.
+func alignSize(siz int64) int64 {
+	if !optDirect || siz <= 0 || directAlignment == 0 {
+		return siz
+	}
+	align := int64(directAlignment)
+	return (siz + align - 1) / align * align
+}
+
+// openFile is os.OpenFile with O_DIRECT if -direct.
+func openFile(f string, flag int, perm os.FileMode) (*os.File, error) {
+	if !optDirect {
+		return os.OpenFile(f, flag, perm)
+	}
+	fp, err := os.OpenFile(f, flag|oDirect, perm)
+	return fp, getDirectError(f, err)
+}
+
+// getDirectError explains EINVAL which is how O_DIRECT open or I/O is
+// rejected by filesystem or due to alignment.
+func getDirectError(f string, err error) error {
+	if optDirect && errors.Is(err, syscall.EINVAL) {
+		return fmt.Errorf("%s: O_DIRECT rejected by filesystem or alignment %d: %s",
+			f, directAlignment, err)
+	}
+	return err
+}
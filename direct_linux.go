@@ -0,0 +1,19 @@
+//go:build linux
+
+package main
+
+import (
+	"syscall"
+)
+
+const oDirect = syscall.O_DIRECT
+
+// getBlockSize returns block size of filesystem of f, which is a multiple
+// of logical block size of the device.
+func getBlockSize(f string) (uint, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(f, &st); err != nil {
+		return 0, err
+	}
+	return uint(st.Bsize), nil
+}
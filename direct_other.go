@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+)
+
+// oDirect is 0 where O_DIRECT is unavailable, -direct is rejected.
+const oDirect = 0
+
+func getBlockSize(f string) (uint, error) {
+	return 0, fmt.Errorf("block size unsupported")
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func Test_alignBuffer(t *testing.T) {
+	for _, align := range []uint{1, 512, 4096} {
+		for _, siz := range []uint{0, 1, 4096, 65536} {
+			b := alignBuffer(siz, align)
+			if uint(len(b)) != siz || uint(cap(b)) != siz {
+				t.Error(align, siz, len(b), cap(b))
+			}
+			if siz > 0 && uint(uintptr(unsafe.Pointer(&b[0])))%align != 0 {
+				t.Error(align, siz, &b[0])
+			}
+		}
+	}
+}
+
+func Test_alignSize(t *testing.T) {
+	direct := optDirect
+	alignment := directAlignment
+	defer func() {
+		optDirect = direct
+		directAlignment = alignment
+	}()
+
+	optDirect = false
+	directAlignment = 4096
+	if n := alignSize(1); n != 1 {
+		t.Error(n)
+	}
+
+	optDirect = true
+	directAlignment = 0
+	if n := alignSize(1); n != 1 {
+		t.Error(n)
+	}
+
+	directAlignment = 4096
+	sizeList := []struct {
+		siz int64
+		x   int64
+	}{
+		{-1, -1},
+		{0, 0},
+		{1, 4096},
+		{4095, 4096},
+		{4096, 4096},
+		{4097, 8192},
+		{1 << 30, 1 << 30},
+	}
+	for _, x := range sizeList {
+		if n := alignSize(x.siz); n != x.x {
+			t.Error(x, n)
+		}
+	}
+}
+
+func Test_initDirect(t *testing.T) {
+	if oDirect == 0 {
+		t.Skip("O_DIRECT unsupported")
+	}
+	direct := optDirect
+	optAlignment := optDirectAlignment
+	alignment := directAlignment
+	defer func() {
+		optDirect = direct
+		optDirectAlignment = optAlignment
+		directAlignment = alignment
+	}()
+
+	d := t.TempDir()
+	optDirect = true
+	optDirectAlignment = 512
+	directAlignment = 512
+	if err := initDirect([]string{d}); err != nil {
+		t.Error(err)
+	}
+	if directAlignment != 512 {
+		t.Error(directAlignment)
+	}
+
+	optDirectAlignment = 0
+	if err := initDirect([]string{d}); err != nil {
+		t.Error(err)
+	}
+	if n, err := getBlockSize(d); err != nil || directAlignment != n {
+		t.Error(directAlignment, n, err)
+	}
+	if directAlignment == 0 || directAlignment&(directAlignment-1) != 0 {
+		t.Error(directAlignment)
+	}
+
+	if err := initDirect([]string{d + "/noent"}); err == nil {
+		t.Error(directAlignment)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	extentGrow = iota
+	extentShrink
+	extentPrealloc
+	extentPreallocKeep
+	extentPunch
+	extentZero
+	extentCollapse
+	numExtentOp
+)
+
+var extentOpNames = []string{"grow", "shrink", "prealloc", "prealloc_keep",
+	"punch", "zero", "collapse"}
+
+// fallocate(2) modes in Linux
+const (
+	fallocKeepSize      = 0x01
+	fallocPunchHole     = 0x02
+	fallocCollapseRange = 0x08
+	fallocZeroRange     = 0x10
+)
+
+// fallocate(2) mode and trace op of each extent op if fallocate(2) is used
+var extentFallocate = []struct {
+	mode uint32
+	op   string
+}{
+	extentPrealloc:     {0, "fallocate"},
+	extentPreallocKeep: {fallocKeepSize, "fallocate_keep_size"},
+	extentPunch:        {fallocPunchHole | fallocKeepSize, "punch_hole"},
+	extentZero:         {fallocZeroRange, "zero_range"},
+	extentCollapse:     {fallocCollapseRange, "collapse_range"},
+}
+
+var zeroBuffer []byte // zeros written if punch or zero is unsupported
+
+func parseExtentOps(s string) ([]int, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+	var l []int
+	for _, x := range strings.Split(s, ",") {
+		found := false
+		for i, name := range extentOpNames {
+			if x == name {
+				l = append(l, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid extent op %s", x)
+		}
+	}
+	return l, nil
+}
+
+func initExtent() {
+	if optExtentOps != nil {
+		zeroBuffer = newBuffer(uint(optExtentBlockSize))
+	}
+}
+
+// getExtentRange returns a range of op for a file of siz bytes, which is
+// block aligned except for the end of file. For shrink, the range is the
+// part to be truncated.
+func getExtentRange(op int, siz int64, r *rand.Rand) (int64, int64, bool) {
+	bs := int64(optExtentBlockSize)
+	numBlock := 1 + r.Int63n(int64(optExtentMaxBlocks))
+	switch op {
+	case extentGrow, extentPrealloc, extentPreallocKeep:
+		return siz, numBlock * bs, true
+	case extentShrink:
+		if siz == 0 {
+			return -1, -1, false
+		}
+		off := r.Int63n((siz-1)/bs+1) * bs // off < siz
+		return off, siz - off, true
+	case extentPunch, extentZero:
+		if siz == 0 {
+			return -1, -1, false
+		}
+		off := r.Int63n((siz+bs-1)/bs) * bs
+		n := numBlock * bs
+		if off+n > siz {
+			n = siz - off
+		}
+		return off, n, true
+	case extentCollapse:
+		// the range must not reach end of file
+		n := siz / bs
+		if n < 2 {
+			return -1, -1, false
+		}
+		if numBlock > n-1 {
+			numBlock = n - 1
+		}
+		return r.Int63n(n-numBlock) * bs, numBlock * bs, true
+	default:
+		assert(false)
+		return -1, -1, false
+	}
+}
+
+// writeZero writes zeros to [off, off+siz) of fp.
+func writeZero(fp *os.File, off int64, siz int64, thr *gThread) error {
+	for siz > 0 {
+		b := zeroBuffer
+		if int64(len(b)) > siz {
+			b = b[:siz]
+		}
+		t := time.Now()
+		n, err := fp.WriteAt(b, off)
+		traceOp(thr, "write", fp.Name(), off, int64(n), err, t)
+		if err != nil {
+			return err
+		}
+		thr.stat.addNumWriteBytes(n)
+		off += int64(n)
+		siz -= int64(n)
+	}
+	return nil
+}
+
+// runExtentOp runs op on fp, and falls back to a similar operation if the
+// fallocate(2) mode is unsupported. Collapse has no fallback and is skipped.
+func runExtentOp(fp *os.File, op int, thr *gThread) error {
+	st, err := fp.Stat()
+	if err != nil {
+		return err
+	}
+	off, siz, ok := getExtentRange(op, st.Size(), thr.rand)
+	if !ok {
+		return nil
+	}
+
+	t := time.Now()
+	switch op {
+	case extentGrow:
+		err = fp.Truncate(off + siz)
+		traceOp(thr, "truncate", fp.Name(), 0, off+siz, err, t)
+	case extentShrink:
+		err = fp.Truncate(off)
+		traceOp(thr, "truncate", fp.Name(), 0, off, err, t)
+	default:
+		x := &extentFallocate[op]
+		err = fallocate(fp, x.mode, off, siz)
+		if !isFallocateUnsupported(err) {
+			traceOp(thr, x.op, fp.Name(), off, siz, err, t)
+			break
+		}
+		thr.stat.incNumExtentFallback(op)
+		switch op {
+		case extentPrealloc:
+			t = time.Now()
+			err = fp.Truncate(off + siz)
+			traceOp(thr, "truncate", fp.Name(), 0, off+siz, err, t)
+		case extentPunch, extentZero:
+			err = writeZero(fp, off, siz, thr)
+		default:
+			return nil // nothing equivalent
+		}
+	}
+	if err != nil {
+		return err
+	}
+	d := time.Since(t)
+	thr.stat.incNumWrite()
+	thr.stat.addWriteLatency(d)
+	thr.stat.addExtentLatency(op, d)
+	return nil
+}
+
+// runExtentOps runs -extent_ops_per_file ops randomly chosen from
+// -extent_ops on a write path.
+func runExtentOps(fp *os.File, thr *gThread) error {
+	for i := uint(0); i < optExtentOpsPerFile; i++ {
+		op := optExtentOps[thr.rand.Intn(len(optExtentOps))]
+		if err := runExtentOp(fp, op, thr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func printExtentStat(tsv []threadStat) {
+	lat := make([]latencyStat, numExtentOp)
+	numFallback := make([]uint64, numExtentOp)
+	for i := 0; i < len(tsv); i++ {
+		for j := 0; j < len(tsv[i].extentLatency) && j < len(lat); j++ {
+			lat[j].merge(&tsv[i].extentLatency[j])
+		}
+		for j := 0; j < len(tsv[i].numExtentFallback) && j < len(numFallback); j++ {
+			numFallback[j] += tsv[i].numExtentFallback[j]
+		}
+	}
+	for i := range lat {
+		if lat[i].Count == 0 && numFallback[i] == 0 {
+			continue
+		}
+		fmt.Printf("extent %s: %d latency avg %s p50 %s p99 %s max %s",
+			extentOpNames[i], lat[i].Count,
+			getLatencyString(lat[i].mean()), getLatencyString(lat[i].percentile(50)),
+			getLatencyString(lat[i].percentile(99)),
+			getLatencyString(time.Duration(lat[i].Max)))
+		if numFallback[i] != 0 {
+			fmt.Printf(" fallback %d", numFallback[i])
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_parseExtentOps(t *testing.T) {
+	validList := []struct {
+		s string
+		l []int
+	}{
+		{"", nil},
+		{"grow", []int{extentGrow}},
+		{"punch,collapse,punch", []int{extentPunch, extentCollapse, extentPunch}},
+	}
+	for _, x := range validList {
+		l, err := parseExtentOps(x.s)
+		if err != nil || len(l) != len(x.l) {
+			t.Error(x.s, l, err)
+			continue
+		}
+		for i := range l {
+			if l[i] != x.l[i] {
+				t.Error(x.s, l)
+			}
+		}
+	}
+
+	for _, s := range []string{",", "grow,", "xxx", "punch,xxx"} {
+		if l, err := parseExtentOps(s); err == nil {
+			t.Error(s, l)
+		}
+	}
+}
+
+func Test_getExtentRange(t *testing.T) {
+	blockSize := optExtentBlockSize
+	maxBlocks := optExtentMaxBlocks
+	defer func() {
+		optExtentBlockSize = blockSize
+		optExtentMaxBlocks = maxBlocks
+	}()
+	optExtentBlockSize = 4096
+	optExtentMaxBlocks = 4
+
+	r := rand.New(rand.NewSource(1))
+	for op := 0; op < numExtentOp; op++ {
+		for _, siz := range []int64{0, 1, 4096, 5000, 8192, 100000} {
+			for i := 0; i < 100; i++ {
+				off, n, ok := getExtentRange(op, siz, r)
+				if !ok {
+					if (op == extentCollapse && siz >= 8192) ||
+						(op != extentCollapse && siz > 0) {
+						t.Error(op, siz)
+					}
+					break
+				}
+				if off < 0 || n <= 0 {
+					t.Error(op, siz, off, n)
+				}
+				switch op {
+				case extentGrow, extentPrealloc, extentPreallocKeep:
+					if off != siz || n%4096 != 0 || n > 4*4096 {
+						t.Error(op, siz, off, n)
+					}
+				case extentShrink, extentPunch, extentZero:
+					if off%4096 != 0 || off+n > siz {
+						t.Error(op, siz, off, n)
+					}
+				case extentCollapse:
+					if off%4096 != 0 || off+n >= siz || n%4096 != 0 {
+						t.Error(op, siz, off, n)
+					}
+				}
+			}
+		}
+	}
+}
+
+func Test_runExtentOp(t *testing.T) {
+	ops := optExtentOps
+	blockSize := optExtentBlockSize
+	maxBlocks := optExtentMaxBlocks
+	defer func() {
+		optExtentOps = ops
+		optExtentBlockSize = blockSize
+		optExtentMaxBlocks = maxBlocks
+		zeroBuffer = nil
+	}()
+	optExtentOps = []int{extentZero}
+	optExtentBlockSize = 4096
+	optExtentMaxBlocks = 1
+	initExtent()
+
+	fp, err := os.Create(filepath.Join(t.TempDir(), "x"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer fp.Close()
+	thr := newWrite(0, 4096)
+	for _, op := range []int{extentGrow, extentGrow, extentPrealloc, extentPunch,
+		extentZero, extentShrink} {
+		if err := runExtentOp(fp, op, &thr); err != nil {
+			t.Error(op, err)
+		}
+	}
+	st, err := fp.Stat()
+	if err != nil {
+		t.Error(err)
+	} else if siz := st.Size(); siz%4096 != 0 || siz >= 3*4096 {
+		t.Error(siz)
+	}
+	if thr.stat.numWrite != 6 {
+		t.Error(thr.stat.numWrite)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+func fallocate(fp *os.File, mode uint32, off int64, siz int64) error {
+	for {
+		err := syscall.Fallocate(int(fp.Fd()), mode, off, siz)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// isFallocateUnsupported returns true if err means the filesystem or the
+// kernel does not support the mode.
+func isFallocateUnsupported(err error) bool {
+	return errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.ENOSYS)
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+var errFallocateUnsupported = errors.New("fallocate unsupported")
+
+func fallocate(fp *os.File, mode uint32, off int64, siz int64) error {
+	return errFallocateUnsupported
+}
+
+func isFallocateUnsupported(err error) bool {
+	return errors.Is(err, errFallocateUnsupported)
+}
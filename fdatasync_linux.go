@@ -0,0 +1,12 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+func fdatasync(fp *os.File) error {
+	return syscall.Fdatasync(int(fp.Fd()))
+}
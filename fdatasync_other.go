@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"os"
+)
+
+// fdatasync falls back to fsync(2) where fdatasync(2) is unavailable.
+func fdatasync(fp *os.File) error {
+	return fp.Sync()
+}
@@ -73,6 +73,19 @@ func loadFlistFile(flistFile string) ([]string, error) {
 }
 
 func createFlistFile(input []string, flistFile string, ignoreDot bool, force bool) error {
+	var fl []string
+	for _, f := range input {
+		if l, err := initFlist(f, ignoreDot); err != nil {
+			return err
+		} else {
+			fmt.Println(len(l), "files scanned from", f)
+			fl = append(fl, l...)
+		}
+	}
+	return writeFlistFile(fl, flistFile, force)
+}
+
+func writeFlistFile(fl []string, flistFile string, force bool) error {
 	if _, err := os.Stat(flistFile); err == nil {
 		if force {
 			if err := os.Remove(flistFile); err != nil {
@@ -85,15 +98,6 @@ func createFlistFile(input []string, flistFile string, ignoreDot bool, force boo
 		}
 	}
 
-	var fl []string
-	for _, f := range input {
-		if l, err := initFlist(f, ignoreDot); err != nil {
-			return err
-		} else {
-			fmt.Println(len(l), "files scanned from", f)
-			fl = append(fl, l...)
-		}
-	}
 	sort.Strings(fl)
 
 	fp, err := os.OpenFile(flistFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
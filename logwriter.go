@@ -0,0 +1,282 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// logFile is a log file shared among writers of logwriter personality.
+type logFile struct {
+	path       string
+	size       int64  // atomic
+	gen        uint64 // atomic, incremented on rotation
+	rotated    []string
+	compressed []string
+}
+
+// logShared is a set of log files shared among writers in a process,
+// created under an input path of the first writer.
+type logShared struct {
+	mtx   sync.Mutex // serializes rotation and reopen
+	files []*logFile
+}
+
+// logState is per writer state of logwriter personality.
+// Each writer has its own file descriptors opened with O_APPEND, and
+// reopens a log file when it has been rotated by another writer.
+type logState struct {
+	shared *logShared
+	fps    []*os.File
+	gens   []uint64
+}
+
+var (
+	logSharedMtx     sync.Mutex
+	logSharedFiles   *logShared
+	logNumWriterDone uint
+)
+
+func getNumProcessWriter() uint {
+	n := uint(0)
+	for i := optNumReader; i < optNumReader+optNumWriter; i++ {
+		if isProcessThread(i) {
+			n++
+		}
+	}
+	return n
+}
+
+func acquireLogShared(thr *gThread) (*logShared, error) {
+	logSharedMtx.Lock()
+	defer logSharedMtx.Unlock()
+
+	if logSharedFiles != nil {
+		return logSharedFiles, nil
+	}
+
+	// log files are named after the first writer
+	d := thr.stat.inputPath
+	this := &logShared{}
+	for i := uint(0); i < optLogFiles; i++ {
+		f, err := creatNamedWritePath(d, fmt.Sprintf("log%d", i), thr,
+			func(f string) error {
+				t := time.Now()
+				err := creatLogFile(f)
+				traceOp(thr, "create", f, 0, 0, err, t)
+				return err
+			})
+		if err != nil {
+			return nil, err
+		}
+		this.files = append(this.files, &logFile{path: f})
+		thr.dir.writePaths = append(thr.dir.writePaths, f)
+	}
+	if optDirsyncWritePaths {
+		if err := traceFsyncInode(d, thr); err != nil {
+			return nil, err
+		}
+	}
+	logSharedFiles = this
+	return this, nil
+}
+
+// releaseLogShared registers rotated log files as write paths of the
+// last writer.
+func releaseLogShared(thr *gThread) {
+	logSharedMtx.Lock()
+	defer logSharedMtx.Unlock()
+
+	logNumWriterDone++
+	if logNumWriterDone < getNumProcessWriter() {
+		return
+	}
+	if x := logSharedFiles; x != nil {
+		for _, lf := range x.files {
+			thr.dir.writePaths = append(thr.dir.writePaths, lf.rotated...)
+			thr.dir.writePaths = append(thr.dir.writePaths, lf.compressed...)
+		}
+	}
+	logSharedFiles = nil
+	logNumWriterDone = 0
+}
+
+func creatLogFile(f string) error {
+	fp, err := os.OpenFile(f, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	return fp.Close()
+}
+
+func logWriterEntry(f string, thr *gThread) error {
+	// readers are not part of logging
+	if thr.isReader() {
+		return readEntry(f, thr)
+	}
+	if isWriteDone(thr) {
+		return nil
+	}
+	if thr.dir.log == nil {
+		x, err := acquireLogShared(thr)
+		if err != nil {
+			return err
+		}
+		n := len(x.files)
+		thr.dir.log = &logState{
+			shared: x,
+			fps:    make([]*os.File, n),
+			gens:   make([]uint64, n),
+		}
+	}
+	return appendLog(thr.dir.log, thr)
+}
+
+// reopen opens i'th log file under the lock, so that it never sees the log
+// file missing in the middle of rotation.
+func (this *logState) reopen(i int) error {
+	lf := this.shared.files[i]
+	this.shared.mtx.Lock()
+	defer this.shared.mtx.Unlock()
+
+	if this.fps[i] != nil {
+		this.fps[i].Close()
+		this.fps[i] = nil
+	}
+	fp, err := os.OpenFile(lf.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	this.fps[i] = fp
+	this.gens[i] = atomic.LoadUint64(&lf.gen)
+	return nil
+}
+
+func appendLog(this *logState, thr *gThread) error {
+	i := thr.rand.Intn(len(this.fps))
+	lf := this.shared.files[i]
+
+	// reopen if rotated since last open
+	if this.fps[i] == nil || this.gens[i] != atomic.LoadUint64(&lf.gen) {
+		if err := this.reopen(i); err != nil {
+			return err
+		}
+	}
+
+	// append a record
+	n := optLogRecordSize.sample(thr.rand)
+	if n <= 0 {
+		n = 1
+	}
+	t := time.Now()
+	if err := writeData(this.fps[i], n, thr); err != nil {
+		return err
+	}
+	thr.stat.incNumOp()
+	thr.stat.addOpLatency(time.Since(t))
+
+	if atomic.AddInt64(&lf.size, n) >= optLogRotateSize {
+		return this.shared.rotate(lf, thr)
+	}
+	return nil
+}
+
+// rotate renames the log file and creates a new one, then compresses or
+// deletes old rotations.
+func (this *logShared) rotate(lf *logFile, thr *gThread) error {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+
+	// already rotated by another writer
+	if atomic.LoadInt64(&lf.size) < optLogRotateSize {
+		return nil
+	}
+
+	gen := atomic.LoadUint64(&lf.gen) + 1
+	old := fmt.Sprintf("%s.%d", lf.path, gen)
+	if err := traceRename(lf.path, old, thr); err != nil {
+		return err
+	}
+	lf.rotated = append(lf.rotated, old)
+	t := time.Now()
+	err := creatLogFile(lf.path)
+	traceOp(thr, "create", lf.path, 0, 0, err, t)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt64(&lf.size, 0)
+	atomic.StoreUint64(&lf.gen, gen)
+
+	if uint(len(lf.rotated)) > optLogKeep {
+		f := lf.rotated[0]
+		lf.rotated = lf.rotated[1:]
+		if optLogCompress {
+			if err := compressLog(f); err != nil {
+				return err
+			}
+			lf.compressed = append(lf.compressed, f+".gz")
+		}
+		if err := traceRemove(f, thr); err != nil {
+			return err
+		}
+	}
+	if uint(len(lf.compressed)) > optLogKeep {
+		f := lf.compressed[0]
+		lf.compressed = lf.compressed[1:]
+		if err := traceRemove(f, thr); err != nil {
+			return err
+		}
+	}
+
+	if optDirsyncWritePaths {
+		if err := traceFsyncInode(filepath.Dir(lf.path), thr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func compressLog(f string) error {
+	src, err := os.Open(f)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(f+".gz", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	w := gzip.NewWriter(dst)
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return dst.Close()
+}
+
+func logWriterFinish(thr *gThread) error {
+	if !thr.isWriter() {
+		return nil
+	}
+	if x := thr.dir.log; x != nil {
+		for i, fp := range x.fps {
+			if fp != nil {
+				fp.Close()
+				x.fps[i] = nil
+			}
+		}
+		thr.dir.log = nil
+	}
+	releaseLogShared(thr)
+	return nil
+}
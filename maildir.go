@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// maildirState is per writer state of maildir personality.
+// Each message is delivered to tmp/, renamed to new/, then later
+// renamed to cur/ and finally deleted.
+type maildirState struct {
+	folders []string
+	newl    []string
+	curl    []string
+	counter uint64
+}
+
+func initMaildir(thr *gThread) (*maildirState, error) {
+	// maildir is under input path with a write path name
+	root, err := creatNamedWritePath(thr.stat.inputPath, "maildir", thr,
+		func(f string) error {
+			return traceMkdir(f, 0755, thr)
+		})
+	if err != nil {
+		return nil, err
+	}
+	thr.dir.writePaths = append(thr.dir.writePaths, root)
+
+	this := &maildirState{}
+	for i := uint(0); i < optMaildirFolders; i++ {
+		d := filepath.Join(root, fmt.Sprintf("folder%d", i))
+		if err := traceMkdir(d, 0755, thr); err != nil {
+			return nil, err
+		}
+		thr.dir.writePaths = append(thr.dir.writePaths, d)
+		for _, x := range []string{"tmp", "new", "cur"} {
+			dd := filepath.Join(d, x)
+			if err := traceMkdir(dd, 0755, thr); err != nil {
+				return nil, err
+			}
+			thr.dir.writePaths = append(thr.dir.writePaths, dd)
+		}
+		this.folders = append(this.folders, d)
+	}
+	return this, nil
+}
+
+func maildirEntry(f string, thr *gThread) error {
+	// readers are not part of maildir delivery
+	if thr.isReader() {
+		return readEntry(f, thr)
+	}
+	if isWriteDone(thr) {
+		return nil
+	}
+	if thr.dir.maildir == nil {
+		if x, err := initMaildir(thr); err != nil {
+			return err
+		} else {
+			thr.dir.maildir = x
+		}
+	}
+	return deliverMaildir(thr.dir.maildir, thr)
+}
+
+func deliverMaildir(this *maildirState, thr *gThread) error {
+	t := time.Now()
+	d := this.folders[thr.rand.Intn(len(this.folders))]
+	name := fmt.Sprintf("%d.gid%d_%d.dirload", t.Unix(), thr.gid, this.counter)
+	this.counter++
+
+	// write and fsync a message in tmp/
+	tmpf := filepath.Join(d, "tmp", name)
+	tt := time.Now()
+	fp, err := os.OpenFile(tmpf, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	traceOp(thr, "create", tmpf, 0, 0, err, tt)
+	if err != nil {
+		return err
+	}
+	if n := optMaildirMessageSize.sample(thr.rand); n > 0 {
+		err = writeData(fp, n, thr)
+	}
+	if err == nil {
+		err = traceSync(fp, thr)
+	}
+	if cerr := traceClose(fp, thr); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		// not yet delivered, don't leave a partial message in tmp/
+		if err := traceRemove(tmpf, thr); err != nil {
+			dbg(err)
+		}
+		return err
+	}
+
+	// deliver the message to new/
+	newf := filepath.Join(d, "new", name)
+	if err := traceRename(tmpf, newf, thr); err != nil {
+		return err
+	}
+	if optDirsyncWritePaths {
+		if err := traceFsyncInode(filepath.Dir(newf), thr); err != nil {
+			return err
+		}
+	}
+	this.newl = append(this.newl, newf)
+	thr.stat.incNumOp()
+	thr.stat.addOpLatency(time.Since(t))
+
+	// move the oldest message in new/ to cur/ as seen
+	if uint(len(this.newl)) > optMaildirBacklog {
+		f := this.newl[0]
+		this.newl = this.newl[1:]
+		curf := filepath.Join(filepath.Dir(filepath.Dir(f)), "cur", filepath.Base(f)+":2,S")
+		if err := traceRename(f, curf, thr); err != nil {
+			return err
+		}
+		this.curl = append(this.curl, curf)
+	}
+
+	// delete the oldest message in cur/
+	if uint(len(this.curl)) > optMaildirBacklog {
+		f := this.curl[0]
+		this.curl = this.curl[1:]
+		if err := traceRemove(f, thr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maildirFinish registers remaining messages as write paths.
+func maildirFinish(thr *gThread) error {
+	if x := thr.dir.maildir; x != nil {
+		thr.dir.writePaths = append(thr.dir.writePaths, x.newl...)
+		thr.dir.writePaths = append(thr.dir.writePaths, x.curl...)
+		x.newl = nil
+		x.curl = nil
+	}
+	return nil
+}
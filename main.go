@@ -3,129 +3,327 @@ package main
 import (
 	"flag"
 	"fmt"
-	"math/rand"
 	"os"
 	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
 )
 
 var (
-	version               [3]int = [3]int{0, 4, 8}
-	optNumSet             uint
-	optNumReader          uint
-	optNumWriter          uint
-	optNumRepeat          int
-	optTimeMinute         uint
-	optTimeSecond         uint
-	optMonitorIntMinute   uint
-	optMonitorIntSecond   uint
-	optStatOnly           bool
-	optIgnoreDot          bool
-	optFollowSymlink      bool
-	optReadBufferSize     uint
-	optReadSize           int
-	optWriteBufferSize    uint
-	optWriteSize          int
-	optRandomWriteData    bool
-	optNumWritePaths      int
-	optTruncateWritePaths bool
-	optFsyncWritePaths    bool
-	optDirsyncWritePaths  bool
-	optKeepWritePaths     bool
-	optCleanWritePaths    bool
-	optWritePathsBase     string
-	optWritePathsType     []fileType
-	optPathIter           uint
-	optFlistFile          string
-	optFlistFileCreate    bool
-	optForce              bool
-	optVerbose            bool
-	optDebug              bool
+	version                   [3]int = [3]int{0, 4, 8}
+	optNumSet                 uint
+	optNumReader              uint
+	optNumWriter              uint
+	optNumRepeat              int
+	optTimeMinute             uint
+	optTimeSecond             uint
+	optMonitorIntMinute       uint
+	optMonitorIntSecond       uint
+	optStatOnly               bool
+	optIgnoreDot              bool
+	optFollowSymlink          bool
+	optAccessMethod           int
+	optAccessPattern          int
+	optAccessBlockSize        uint
+	optAccessStride           uint
+	optAccessLocality         uint
+	optDirect                 bool
+	optDirectAlignment        uint
+	optReadBufferSize         uint
+	optReadSize               *sizeDist
+	optWriteBufferSize        uint
+	optWriteSize              *sizeDist
+	optRandomWriteData        bool
+	optWriteData              int
+	optWriteDataPattern       string
+	optWriteDataCompressRatio float64
+	optWriteDataDedupRatio    float64
+	optWriteDataBlockSize     uint
+	optNumWritePaths          int
+	optTruncateWritePaths     bool
+	optExtentOps              []int
+	optExtentOpsPerFile       uint
+	optExtentBlockSize        uint
+	optExtentMaxBlocks        uint
+	optFsyncWritePaths        bool
+	optSyncOpen               int
+	optSyncType               int
+	optSyncEveryWrites        uint
+	optSyncEveryBytes         int64
+	optSyncFileRange          bool
+	optSyncfsIntSecond        uint
+	optDirsyncWritePaths      bool
+	optKeepWritePaths         bool
+	optCleanWritePaths        bool
+	optWritePathsBase         string
+	optWritePathsType         []fileType
+	optCopyMethod             int
+	optPathIter               uint
+	optSeed                   int64
+	optFlistFile              string
+	optFlistFileCreate        bool
+	optForce                  bool
+	optVerbose                bool
+	optDebug                  bool
+	optServerAddr             string
+	optAgentAddr              string
+	optCoordinatorAgents      []string
+	optNumProcess             uint
+	optConfig                 string
+	optProfile                string
+	optDumpConfig             bool
+	optScenario               string
+	optSweep                  string
+	optSweepCsv               string
+	optPersonality            *personality
+	optMaildirFolders         uint
+	optMaildirMessageSize     *sizeDist
+	optMaildirBacklog         uint
+	optDbDataSize             int64
+	optDbPageSize             uint
+	optDbPagesPerCommit       uint
+	optDbCheckpointInterval   uint
+	optWebZipfExponent        float64
+	optBuildMissingLookups    uint
+	optBuildReadsPerOutput    uint
+	optBuildReadSize          *sizeDist
+	optBuildWriteSize         *sizeDist
+	optLogFiles               uint
+	optLogRecordSize          *sizeDist
+	optLogRotateSize          int64
+	optLogKeep                uint
+	optLogCompress            bool
+	optPopulate               bool
+	optPopulateFiles          uint
+	optPopulateDepth          uint
+	optPopulateFanout         uint
+	optPopulateFileSize       *sizeDist
+	optTraceFile              string
+	optReplay                 string
+	optReplaySpeed            float64
+	optStraceImport           string
+	optStraceOutput           string
+	optStraceRoot             string
 )
 
-func getVersionString() string {
-	return fmt.Sprintf("%d.%d.%d", version[0], version[1], version[2])
-}
-
-func printVersion() {
-	fmt.Println(getVersionString())
-}
-
-func usage(progname string) {
-	fmt.Fprintln(os.Stderr, "usage: "+progname+": [<options>] <paths>")
-	flag.PrintDefaults()
-}
-
-func main() {
-	progname := path.Base(os.Args[0])
-
-	optNumSetAddr := flag.Int("num_set", 1, "Number of sets to run")
-	optNumReaderAddr := flag.Int("num_reader", 0,
+var (
+	optNumSetAddr = flag.Int("num_set", 1,
+		"Number of sets to run")
+	optNumReaderAddr = flag.Int("num_reader", 0,
 		"Number of reader Goroutines")
-	optNumWriterAddr := flag.Int("num_writer", 0,
+	optNumWriterAddr = flag.Int("num_writer", 0,
 		"Number of writer Goroutines")
-	optNumRepeatAddr := flag.Int("num_repeat", -1,
+	optNumProcessAddr = flag.Int("num_process", 1,
+		"Number of processes to run reader and writer Goroutines, fork child processes if > 1")
+	optNumRepeatAddr = flag.Int("num_repeat", -1,
 		"Exit Goroutines after specified iterations if > 0")
-	optTimeMinuteAddr := flag.Int("time_minute", 0,
+	optTimeMinuteAddr = flag.Int("time_minute", 0,
 		"Exit Goroutines after sum of this and -time_second option if > 0")
-	optTimeSecondAddr := flag.Int("time_second", 0,
+	optTimeSecondAddr = flag.Int("time_second", 0,
 		"Exit Goroutines after sum of this and -time_minute option if > 0")
-	optMonitorIntMinuteAddr := flag.Int("monitor_interval_minute", 0,
+	optMonitorIntMinuteAddr = flag.Int("monitor_interval_minute", 0,
 		"Monitor Goroutines every sum of this and -monitor_interval_second option if > 0")
-	optMonitorIntSecondAddr := flag.Int("monitor_interval_second", 0,
+	optMonitorIntSecondAddr = flag.Int("monitor_interval_second", 0,
 		"Monitor Goroutines every sum of this and -monitor_interval_minute option if > 0")
-	optStatOnlyAddr := flag.Bool("stat_only", false,
+	optStatOnlyAddr = flag.Bool("stat_only", false,
 		"Do not read file data")
-	optIgnoreDotAddr := flag.Bool("ignore_dot", false,
+	optIgnoreDotAddr = flag.Bool("ignore_dot", false,
 		"Ignore entries start with .")
-	optFollowSymlinkAddr := flag.Bool("follow_symlink", false,
+	optFollowSymlinkAddr = flag.Bool("follow_symlink", false,
 		"Follow symbolic links for read unless directory")
-	optReadBufferSizeAddr := flag.Int("read_buffer_size", 1<<16,
+	optAccessMethodAddr = flag.String("access_method", "syscall",
+		"Access method for read and write of regular files, mmap reads and writes through shared mapping [syscall|mmap]")
+	optAccessPatternAddr = flag.String("access_pattern", "seq",
+		"Access pattern within regular files, non seq patterns use pread(2) and pwrite(2) per -access_block_size [seq|random|stride|reverse|locality]")
+	optAccessBlockSizeAddr = flag.String("access_block_size", "0",
+		"Block size of non seq -access_pattern, use read or write buffer size if 0")
+	optAccessStrideAddr = flag.Int("access_stride", 2,
+		"Stride in blocks of -access_pattern=stride")
+	optAccessLocalityAddr = flag.Int("access_locality", 16,
+		"Maximum distance in blocks from previous block of -access_pattern=locality")
+	optDirectAddr = flag.Bool("direct", false,
+		"Use O_DIRECT for read and write of regular files, buffer and residual sizes are rounded up to direct alignment")
+	optDirectAlignmentAddr = flag.Int("direct_alignment", 0,
+		"Alignment of buffer address, buffer size and residual size for -direct, use block size of filesystem of <paths> if 0")
+	optReadBufferSizeAddr = flag.Int("read_buffer_size", 1<<16,
 		"Read buffer size")
-	optReadSizeAddr := flag.Int("read_size", -1,
-		"Read residual size per file read, use < read_buffer_size random size if 0")
-	optWriteBufferSizeAddr := flag.Int("write_buffer_size", 1<<16,
+	optReadSizeAddr = flag.String("read_size", "-1",
+		"Read residual size per file read, read until EOF if -1, use <= read_buffer_size random size if 0, "+
+			"or [<size>|<min>..<max>|lognormal:<median>:<sigma>|bimodal:<small>:<large>:<ratio>|<size or range>=<weight>,...]")
+	optWriteBufferSizeAddr = flag.Int("write_buffer_size", 1<<16,
 		"Write buffer size")
-	optWriteSizeAddr := flag.Int("write_size", -1,
-		"Write residual size per file write, use < write_buffer_size random size if 0")
-	optRandomWriteDataAddr := flag.Bool("random_write_data", false,
-		"Use pseudo random write data")
-	optNumWritePathsAddr := flag.Int("num_write_paths", 1<<10,
+	optWriteSizeAddr = flag.String("write_size", "-1",
+		"Write residual size per file write, do not write if -1, use <= write_buffer_size random size if 0, "+
+			"or [<size>|<min>..<max>|lognormal:<median>:<sigma>|bimodal:<small>:<large>:<ratio>|<size or range>=<weight>,...]")
+	optRandomWriteDataAddr = flag.Bool("random_write_data", false,
+		"Use pseudo random printable write data, same as -write_data=ascii")
+	optWriteDataAddr = flag.String("write_data", "pattern",
+		"Write data type [pattern|zero|ascii|random|compress|dedup]")
+	optWriteDataPatternAddr = flag.String("write_data_pattern", "A",
+		"Pattern repeated in write data for -write_data=pattern")
+	optWriteDataCompressRatioAddr = flag.Float64("write_data_compress_ratio", 2,
+		"Target compress ratio of write data for -write_data=compress")
+	optWriteDataDedupRatioAddr = flag.Float64("write_data_dedup_ratio", 2,
+		"Target dedup ratio of write data for -write_data=dedup")
+	optWriteDataBlockSizeAddr = flag.Int("write_data_block_size", 4096,
+		"Block size of write data for -write_data=compress|dedup")
+	optNumWritePathsAddr = flag.Int("num_write_paths", 1<<10,
 		"Exit writer Goroutines after creating specified files or directories if > 0")
-	optTruncateWritePathsAddr := flag.Bool("truncate_write_paths", false,
+	optTruncateWritePathsAddr = flag.Bool("truncate_write_paths", false,
 		"ftruncate(2) write paths for regular files instead of write(2)")
-	optFsyncWritePathsAddr := flag.Bool("fsync_write_paths", false,
+	optExtentOpsAddr = flag.String("extent_ops", "",
+		"Comma separated operations randomly applied to regular write paths after write [grow|shrink|prealloc|prealloc_keep|punch|zero|collapse]")
+	optExtentOpsPerFileAddr = flag.Int("extent_ops_per_file", 1,
+		"Number of -extent_ops per regular write path")
+	optExtentBlockSizeAddr = flag.String("extent_block_size", "4k",
+		"Unit of offset and length of -extent_ops, should be a multiple of filesystem block size for collapse")
+	optExtentMaxBlocksAddr = flag.Int("extent_max_blocks", 16,
+		"Maximum length in -extent_block_size of -extent_ops")
+	optFsyncWritePathsAddr = flag.Bool("fsync_write_paths", false,
 		"fsync(2) write paths")
-	optDirsyncWritePathsAddr := flag.Bool("dirsync_write_paths", false,
+	optSyncOpenAddr = flag.String("sync_open", "none",
+		"Open regular files of write paths with O_SYNC or O_DSYNC [none|sync|dsync]")
+	optSyncTypeAddr = flag.String("sync_type", "fsync",
+		"Flush type for -fsync_write_paths and -sync_every_writes|bytes [fsync|fdatasync]")
+	optSyncEveryWritesAddr = flag.Int("sync_every_writes", 0,
+		"Flush write paths every specified number of write(2) if > 0")
+	optSyncEveryBytesAddr = flag.String("sync_every_bytes", "0",
+		"Flush write paths every specified bytes written if > 0")
+	optSyncFileRangeAddr = flag.Bool("sync_file_range", false,
+		"sync_file_range(2) with SYNC_FILE_RANGE_WRITE after each write(2)")
+	optSyncfsIntSecondAddr = flag.Int("syncfs_interval_second", 0,
+		"syncfs(2) filesystems of <paths> every specified seconds from a background Goroutine if > 0")
+	optDirsyncWritePathsAddr = flag.Bool("dirsync_write_paths", false,
 		"fsync(2) parent directories of write paths")
-	optKeepWritePathsAddr := flag.Bool("keep_write_paths", false,
+	optKeepWritePathsAddr = flag.Bool("keep_write_paths", false,
 		"Do not unlink write paths after writer Goroutines exit")
-	optCleanWritePathsAddr := flag.Bool("clean_write_paths", false,
+	optCleanWritePathsAddr = flag.Bool("clean_write_paths", false,
 		"Unlink existing write paths and exit")
-	optWritePathsBaseAddr := flag.String("write_paths_base", "x",
+	optWritePathsBaseAddr = flag.String("write_paths_base", "x",
 		"Base name for write paths")
-	optWritePathsTypeAddr := flag.String("write_paths_type", "dr",
-		"File types for write paths [d|r|s|l]")
-	optPathIterAddr := flag.String("path_iter", "ordered",
+	optWritePathsTypeAddr = flag.String("write_paths_type", "dr",
+		"File types for write paths, l and c are hardlink and copy of regular file [d|r|s|l|c]")
+	optCopyMethodAddr = flag.String("copy_method", "reflink",
+		"Copy method of write paths type c, later ones are used as fallbacks if unsupported [reflink|copy_file_range|rw]")
+	optPathIterAddr = flag.String("path_iter", "ordered",
 		"<paths> iteration type [walk|ordered|reverse|random]")
-	optFlistFileAddr := flag.String("flist_file", "", "Path to flist file")
-	optFlistFileCreateAddr := flag.Bool("flist_file_create", false,
+	optSeedAddr = flag.Int64("seed", 0,
+		"Seed for pseudo random numbers, use current time if 0")
+	optFlistFileAddr = flag.String("flist_file", "",
+		"Path to flist file")
+	optPopulateAddr = flag.Bool("populate", false,
+		"Populate <paths> with files by -num_writer Goroutines (or number of CPUs if 0) and exit, also create -flist_file if specified")
+	optPopulateFilesAddr = flag.Int("populate_files", 1024,
+		"Number of files to populate per <paths>")
+	optPopulateDepthAddr = flag.Int("populate_depth", 2,
+		"Directory depth of populated files")
+	optPopulateFanoutAddr = flag.Int("populate_fanout", 8,
+		"Number of subdirectories per directory of populated files")
+	optPopulateFileSizeAddr = flag.String("populate_file_size", "4k",
+		"File size of populated files [<size>|<min>..<max>|lognormal:<median>:<sigma>|<size or range>=<weight>,...]")
+	optTraceFileAddr = flag.String("trace_file", "",
+		"Path to JSONL file to record operations of reader and writer Goroutines, suffixed with .<index> for child processes")
+	optReplayAddr = flag.String("replay", "",
+		"Path to JSONL trace file to replay operations against <paths> instead of sets")
+	optReplaySpeedAddr = flag.Float64("replay_speed", 0,
+		"Replay with original timing scaled by specified speed if > 0, as fast as possible if 0")
+	optStraceImportAddr = flag.String("strace_import", "",
+		"Path to output of strace -f -tt -T to convert to trace file for -replay and exit")
+	optStraceOutputAddr = flag.String("strace_output", "",
+		"Path to trace file to write -strace_import result")
+	optStraceRootAddr = flag.String("strace_root", "",
+		"Rebase paths in -strace_import on this directory, drop operations outside, use common directory if empty")
+	optFlistFileCreateAddr = flag.Bool("flist_file_create", false,
 		"Create flist file and exit")
-	optForceAddr := flag.Bool("force", false, "Enable force mode")
-	optVerboseAddr := flag.Bool("verbose", false, "Enable verbose print")
-	optDebugAddr := flag.Bool("debug", false,
+	optForceAddr = flag.Bool("force", false,
+		"Enable force mode")
+	optVerboseAddr = flag.Bool("verbose", false,
+		"Enable verbose print")
+	optDebugAddr = flag.Bool("debug", false,
 		"Create debug log file under home directory")
-	optVersionAddr := flag.Bool("v", false, "Print version and exit")
-	optHelpAddr := flag.Bool("h", false, "Print usage and exit")
+	optPersonalityAddr = flag.String("personality", "",
+		"Workload personality ["+getPersonalityNames()+"]")
+	optMaildirFoldersAddr = flag.Int("maildir_folders", 4,
+		"Number of folders per writer for maildir personality")
+	optMaildirMessageSizeAddr = flag.String("maildir_message_size", "1k..64k",
+		"Message size for maildir personality, either <size> or <min>..<max>")
+	optMaildirBacklogAddr = flag.Int("maildir_backlog", 16,
+		"Number of messages in new/ and cur/ per writer before moved or deleted for maildir personality")
+	optDbDataSizeAddr = flag.String("db_data_size", "16m",
+		"Data file size per writer for db personality")
+	optDbPageSizeAddr = flag.Int("db_page_size", 8192,
+		"Page size for db personality")
+	optDbPagesPerCommitAddr = flag.Int("db_pages_per_commit", 4,
+		"Number of pages written per commit for db personality")
+	optDbCheckpointIntervalAddr = flag.Int("db_checkpoint_interval", 64,
+		"Checkpoint every specified commits for db personality, no checkpoint if 0")
+	optWebZipfExponentAddr = flag.Float64("web_zipf_exponent", 1.1,
+		"Exponent of Zipf distribution to select files for web personality, must be > 1")
+	optBuildMissingLookupsAddr = flag.Int("build_missing_lookups", 3,
+		"Number of lookups of non-existent paths per existing path for build personality")
+	optBuildReadsPerOutputAddr = flag.Int("build_reads_per_output", 32,
+		"Number of paths read per output file by writers for build personality")
+	optBuildReadSizeAddr = flag.String("build_read_size", "lognormal:4k:1",
+		"Read size of each existing path for build personality, supports size distributions as -read_size")
+	optBuildWriteSizeAddr = flag.String("build_write_size", "lognormal:16k:1",
+		"Write size of each output file for build personality, supports size distributions as -read_size")
+	optLogFilesAddr = flag.Int("log_files", 4,
+		"Number of log files shared among writers in a process for logwriter personality, created under input path of the first writer")
+	optLogRecordSizeAddr = flag.String("log_record_size", "64..512",
+		"Record size for logwriter personality, either <size> or <min>..<max>")
+	optLogRotateSizeAddr = flag.String("log_rotate_size", "1m",
+		"Rotate log file when it reaches specified size for logwriter personality")
+	optLogKeepAddr = flag.Int("log_keep", 2,
+		"Number of rotated log files kept for logwriter personality")
+	optLogCompressAddr = flag.Bool("log_compress", false,
+		"Compress rotated log files beyond -log_keep instead of deleting for logwriter personality")
+	optServerAddrAddr = flag.String("server_addr", "",
+		"Listen on address for HTTP control API, use unix:<path> for unix domain socket")
+	optAgentAddrAddr = flag.String("agent_addr", "",
+		"Listen on address for coordinator as agent")
+	optCoordinatorAgentsAddr = flag.String("coordinator_agents", "",
+		"Comma separated agent addresses to distribute workload to as coordinator")
+	optConfigAddr = flag.String("config", "",
+		"Path to JSON config file, options given on command line take precedence")
+	optProfileAddr = flag.String("profile", "",
+		"Profile name in -config file")
+	optScenarioAddr = flag.String("scenario", "",
+		"Path to JSON scenario file to run phases in order instead of sets")
+	optSweepAddr = flag.String("sweep", "",
+		"Run sets for each combination of option values, e.g. \"num_reader=1,2,4;read_buffer_size=4k,64k\"")
+	optSweepCsvAddr = flag.String("sweep_csv", "",
+		"Path to CSV file to write -sweep result")
+	optDumpConfigAddr = flag.Bool("dump_config", false,
+		"Print effective config in JSON and exit")
+	optVersionAddr = flag.Bool("v", false,
+		"Print version and exit")
+	optHelpAddr = flag.Bool("h", false,
+		"Print usage and exit")
+)
 
-	flag.Parse()
-	args := flag.Args()
+func getVersionString() string {
+	return fmt.Sprintf("%d.%d.%d", version[0], version[1], version[2])
+}
+
+func printVersion() {
+	fmt.Println(getVersionString())
+}
+
+func usage(progname string) {
+	fmt.Fprintln(os.Stderr, "usage: "+progname+": [<options>] <paths>")
+	flag.PrintDefaults()
+}
+
+// parseOptions converts flag values into option variables.
+func parseOptions() error {
 	optNumSet = uint(*optNumSetAddr)
 	optNumReader = uint(*optNumReaderAddr)
 	optNumWriter = uint(*optNumWriterAddr)
+	optNumProcess = uint(*optNumProcessAddr)
+	if optNumProcess == 0 {
+		optNumProcess = 1
+	}
 	optNumRepeat = *optNumRepeatAddr
 	if optNumRepeat == 0 || optNumRepeat < -1 {
 		optNumRepeat = -1
@@ -141,52 +339,172 @@ func main() {
 	optStatOnly = *optStatOnlyAddr
 	optIgnoreDot = *optIgnoreDotAddr
 	optFollowSymlink = *optFollowSymlinkAddr
-	optReadBufferSize = uint(*optReadBufferSizeAddr)
+	switch *optAccessMethodAddr {
+	case "syscall":
+		optAccessMethod = accessSyscall
+	case "mmap":
+		if !mmapSupported {
+			return fmt.Errorf("mmap unsupported")
+		}
+		optAccessMethod = accessMmap
+	default:
+		return fmt.Errorf("invalid access method %s", *optAccessMethodAddr)
+	}
+	if n, err := getAccessPattern(*optAccessPatternAddr); err != nil {
+		return err
+	} else {
+		optAccessPattern = n
+	}
+	if optAccessPattern != accessPatternSeq && optAccessMethod == accessMmap {
+		return fmt.Errorf("-access_pattern=%s and -access_method=mmap are exclusive",
+			accessPatternNames[optAccessPattern])
+	}
+	if n := *optAccessStrideAddr; n <= 0 {
+		return fmt.Errorf("invalid access stride %d", n)
+	}
+	optAccessStride = uint(*optAccessStrideAddr)
+	if n := *optAccessLocalityAddr; n <= 0 {
+		return fmt.Errorf("invalid access locality %d", n)
+	}
+	optAccessLocality = uint(*optAccessLocalityAddr)
+	optDirect = *optDirectAddr
+	if optDirect && optAccessMethod == accessMmap {
+		return fmt.Errorf("-direct and -access_method=mmap are exclusive")
+	}
+	if optDirect && oDirect == 0 {
+		return fmt.Errorf("O_DIRECT unsupported")
+	}
+	if n := *optDirectAlignmentAddr; n < 0 || n&(n-1) != 0 || n > maxBufferSize {
+		return fmt.Errorf("invalid direct alignment %d", n)
+	}
+	optDirectAlignment = uint(*optDirectAlignmentAddr)
+	directAlignment = optDirectAlignment // queried on dispatch if 0
+	optReadBufferSize = uint(alignSize(int64(*optReadBufferSizeAddr)))
 	if optReadBufferSize > maxBufferSize {
-		fmt.Println("Invalid read buffer size", optReadBufferSize)
-		os.Exit(1)
+		return fmt.Errorf("invalid read buffer size %d", optReadBufferSize)
 	}
-	optReadSize = *optReadSizeAddr
-	if optReadSize < -1 {
-		optReadSize = -1
-	} else if optReadSize > int(maxBufferSize) {
-		fmt.Println("Invalid read size", optReadSize)
-		os.Exit(1)
+	if d, err := parseResidSize(*optReadSizeAddr, optReadBufferSize); err != nil {
+		return err
+	} else {
+		optReadSize = d
 	}
-	optWriteBufferSize = uint(*optWriteBufferSizeAddr)
+	optWriteBufferSize = uint(alignSize(int64(*optWriteBufferSizeAddr)))
 	if optWriteBufferSize > maxBufferSize {
-		fmt.Println("Invalid write buffer size", optWriteBufferSize)
-		os.Exit(1)
+		return fmt.Errorf("invalid write buffer size %d", optWriteBufferSize)
 	}
-	optWriteSize = *optWriteSizeAddr
-	if optWriteSize < -1 {
-		optWriteSize = -1
-	} else if optWriteSize > int(maxBufferSize) {
-		fmt.Println("Invalid write size", optWriteSize)
-		os.Exit(1)
+	if d, err := parseResidSize(*optWriteSizeAddr, optWriteBufferSize); err != nil {
+		return err
+	} else {
+		optWriteSize = d
+	}
+	if n, err := parseSize(*optAccessBlockSizeAddr); err != nil {
+		return err
+	} else if n = alignSize(n); n < 0 || n > int64(optReadBufferSize) ||
+		n > int64(optWriteBufferSize) {
+		return fmt.Errorf("invalid access block size %d", n)
+	} else {
+		optAccessBlockSize = uint(n)
 	}
 	optRandomWriteData = *optRandomWriteDataAddr
+	if optRandomWriteData {
+		optWriteData = writeDataAscii
+	} else if t, err := getWriteDataType(*optWriteDataAddr); err != nil {
+		return err
+	} else {
+		optWriteData = t
+	}
+	optWriteDataPattern = *optWriteDataPatternAddr
+	if *optWriteDataCompressRatioAddr < 1 {
+		return fmt.Errorf("invalid write data compress ratio %f", *optWriteDataCompressRatioAddr)
+	}
+	optWriteDataCompressRatio = *optWriteDataCompressRatioAddr
+	if *optWriteDataDedupRatioAddr < 1 {
+		return fmt.Errorf("invalid write data dedup ratio %f", *optWriteDataDedupRatioAddr)
+	}
+	optWriteDataDedupRatio = *optWriteDataDedupRatioAddr
+	if *optWriteDataBlockSizeAddr <= 0 {
+		return fmt.Errorf("invalid write data block size %d", *optWriteDataBlockSizeAddr)
+	}
+	optWriteDataBlockSize = uint(*optWriteDataBlockSizeAddr)
 	optNumWritePaths = *optNumWritePathsAddr
 	if optNumWritePaths < -1 {
 		optNumWritePaths = -1
 	}
 	optTruncateWritePaths = *optTruncateWritePathsAddr
+	if l, err := parseExtentOps(*optExtentOpsAddr); err != nil {
+		return err
+	} else {
+		optExtentOps = l
+	}
+	if n := *optExtentOpsPerFileAddr; n < 0 {
+		return fmt.Errorf("invalid extent ops per file %d", n)
+	}
+	optExtentOpsPerFile = uint(*optExtentOpsPerFileAddr)
+	if n, err := parseSize(*optExtentBlockSizeAddr); err != nil {
+		return err
+	} else if n = alignSize(n); n <= 0 || n > maxBufferSize {
+		return fmt.Errorf("invalid extent block size %d", n)
+	} else {
+		optExtentBlockSize = uint(n)
+	}
+	if n := *optExtentMaxBlocksAddr; n <= 0 {
+		return fmt.Errorf("invalid extent max blocks %d", n)
+	}
+	optExtentMaxBlocks = uint(*optExtentMaxBlocksAddr)
 	optFsyncWritePaths = *optFsyncWritePathsAddr
+	switch *optSyncOpenAddr {
+	case "none":
+		optSyncOpen = syncOpenNone
+	case "sync":
+		optSyncOpen = syncOpenSync
+	case "dsync":
+		optSyncOpen = syncOpenDsync
+	default:
+		return fmt.Errorf("invalid sync open type %s", *optSyncOpenAddr)
+	}
+	switch *optSyncTypeAddr {
+	case "fsync":
+		optSyncType = flushFsync
+	case "fdatasync":
+		optSyncType = flushFdatasync
+	default:
+		return fmt.Errorf("invalid sync type %s", *optSyncTypeAddr)
+	}
+	if *optSyncEveryWritesAddr < 0 {
+		return fmt.Errorf("invalid sync every writes %d", *optSyncEveryWritesAddr)
+	}
+	optSyncEveryWrites = uint(*optSyncEveryWritesAddr)
+	if n, err := parseSize(*optSyncEveryBytesAddr); err != nil {
+		return err
+	} else if n < 0 {
+		return fmt.Errorf("invalid sync every bytes %d", n)
+	} else {
+		optSyncEveryBytes = n
+	}
+	optSyncFileRange = *optSyncFileRangeAddr
+	if optSyncFileRange && !syncFileRangeSupported {
+		return fmt.Errorf("sync_file_range unsupported")
+	}
+	if *optSyncfsIntSecondAddr < 0 {
+		return fmt.Errorf("invalid syncfs interval %d", *optSyncfsIntSecondAddr)
+	}
+	if *optSyncfsIntSecondAddr > 0 && !syncfsSupported {
+		return fmt.Errorf("syncfs unsupported")
+	}
+	optSyncfsIntSecond = uint(*optSyncfsIntSecondAddr)
 	optDirsyncWritePaths = *optDirsyncWritePathsAddr
 	optKeepWritePaths = *optKeepWritePathsAddr
 	optCleanWritePaths = *optCleanWritePathsAddr
 	optWritePathsBase = *optWritePathsBaseAddr
 	if len(optWritePathsBase) == 0 {
-		fmt.Println("Empty write paths base")
-		os.Exit(1)
+		return fmt.Errorf("empty write paths base")
 	}
 	if n, err := strconv.Atoi(optWritePathsBase); err == nil {
 		optWritePathsBase = strings.Repeat("x", n)
 		fmt.Println("Using base name", optWritePathsBase, "for write paths")
 	}
 	if s := *optWritePathsTypeAddr; len(s) == 0 {
-		fmt.Println("Empty write paths type")
-		os.Exit(1)
+		return fmt.Errorf("empty write paths type")
 	} else {
 		optWritePathsType = make([]fileType, len(s))
 		for i, x := range s {
@@ -200,13 +518,19 @@ func main() {
 				t = typeSymlink
 			case 'l':
 				t = typeLink
+			case 'c':
+				t = typeCopy
 			default:
-				fmt.Println("Invalid write paths type", string(x))
-				os.Exit(1)
+				return fmt.Errorf("invalid write paths type %s", string(x))
 			}
 			optWritePathsType[i] = t
 		}
 	}
+	if n, err := getCopyMethod(*optCopyMethodAddr); err != nil {
+		return err
+	} else {
+		optCopyMethod = n
+	}
 	switch *optPathIterAddr {
 	case "walk":
 		optPathIter = pathIterWalk
@@ -217,9 +541,9 @@ func main() {
 	case "random":
 		optPathIter = pathIterRandom
 	default:
-		fmt.Println("Invalid path iteration type", *optPathIterAddr)
-		os.Exit(1)
+		return fmt.Errorf("invalid path iteration type %s", *optPathIterAddr)
 	}
+	optSeed = *optSeedAddr
 	optFlistFile = *optFlistFileAddr
 	// using flist file means not walking input directories
 	if len(optFlistFile) != 0 && optPathIter == pathIterWalk {
@@ -227,9 +551,325 @@ func main() {
 		fmt.Println("Using flist, force -path_iter=ordered")
 	}
 	optFlistFileCreate = *optFlistFileCreateAddr
+	optPopulate = *optPopulateAddr
+	if *optPopulateFilesAddr < 0 {
+		return fmt.Errorf("invalid populate files %d", *optPopulateFilesAddr)
+	}
+	optPopulateFiles = uint(*optPopulateFilesAddr)
+	if *optPopulateDepthAddr < 0 {
+		return fmt.Errorf("invalid populate depth %d", *optPopulateDepthAddr)
+	}
+	optPopulateDepth = uint(*optPopulateDepthAddr)
+	if *optPopulateFanoutAddr <= 0 {
+		return fmt.Errorf("invalid populate fanout %d", *optPopulateFanoutAddr)
+	}
+	optPopulateFanout = uint(*optPopulateFanoutAddr)
+	if d, err := parseSizeDist(*optPopulateFileSizeAddr); err != nil {
+		return err
+	} else {
+		optPopulateFileSize = d
+	}
+	optTraceFile = *optTraceFileAddr
+	optReplay = *optReplayAddr
+	optStraceImport = *optStraceImportAddr
+	optStraceOutput = *optStraceOutputAddr
+	optStraceRoot = *optStraceRootAddr
+	if *optReplaySpeedAddr < 0 {
+		return fmt.Errorf("invalid replay speed %f", *optReplaySpeedAddr)
+	}
+	optReplaySpeed = *optReplaySpeedAddr
 	optForce = *optForceAddr
+	optPersonality = nil
+	if s := *optPersonalityAddr; len(s) != 0 {
+		if p, err := getPersonality(s); err != nil {
+			return err
+		} else {
+			optPersonality = p
+		}
+	}
+	if optPersonality != nil && optPersonality.name == "web" {
+		if optNumWriter > 0 {
+			return fmt.Errorf("web personality does not support writer")
+		} else if optPathIter == pathIterWalk {
+			return fmt.Errorf("web personality does not support walk")
+		}
+	}
+	optMaildirFolders = uint(*optMaildirFoldersAddr)
+	if optMaildirFolders == 0 {
+		optMaildirFolders = 1
+	}
+	if d, err := parseSizeDist(*optMaildirMessageSizeAddr); err != nil {
+		return err
+	} else {
+		optMaildirMessageSize = d
+	}
+	optMaildirBacklog = uint(*optMaildirBacklogAddr)
+	if *optDbPageSizeAddr <= 0 {
+		return fmt.Errorf("invalid db page size %d", *optDbPageSizeAddr)
+	}
+	optDbPageSize = uint(*optDbPageSizeAddr)
+	if n, err := parseSize(*optDbDataSizeAddr); err != nil {
+		return err
+	} else if n < int64(optDbPageSize) {
+		return fmt.Errorf("invalid db data size %s", *optDbDataSizeAddr)
+	} else {
+		optDbDataSize = n
+	}
+	optDbPagesPerCommit = uint(*optDbPagesPerCommitAddr)
+	if optDbPagesPerCommit == 0 {
+		optDbPagesPerCommit = 1
+	}
+	if *optDbCheckpointIntervalAddr < 0 {
+		return fmt.Errorf("invalid db checkpoint interval %d", *optDbCheckpointIntervalAddr)
+	}
+	optDbCheckpointInterval = uint(*optDbCheckpointIntervalAddr)
+	if *optWebZipfExponentAddr <= 1 {
+		return fmt.Errorf("invalid web zipf exponent %f", *optWebZipfExponentAddr)
+	}
+	optWebZipfExponent = *optWebZipfExponentAddr
+	if *optBuildMissingLookupsAddr < 0 {
+		return fmt.Errorf("invalid build missing lookups %d", *optBuildMissingLookupsAddr)
+	}
+	optBuildMissingLookups = uint(*optBuildMissingLookupsAddr)
+	if *optBuildReadsPerOutputAddr <= 0 {
+		return fmt.Errorf("invalid build reads per output %d", *optBuildReadsPerOutputAddr)
+	}
+	optBuildReadsPerOutput = uint(*optBuildReadsPerOutputAddr)
+	if d, err := parseSizeDist(*optBuildReadSizeAddr); err != nil {
+		return err
+	} else {
+		optBuildReadSize = d
+	}
+	if d, err := parseSizeDist(*optBuildWriteSizeAddr); err != nil {
+		return err
+	} else {
+		optBuildWriteSize = d
+	}
+	if *optLogFilesAddr <= 0 {
+		return fmt.Errorf("invalid log files %d", *optLogFilesAddr)
+	}
+	optLogFiles = uint(*optLogFilesAddr)
+	if d, err := parseSizeDist(*optLogRecordSizeAddr); err != nil {
+		return err
+	} else {
+		optLogRecordSize = d
+	}
+	if n, err := parseSize(*optLogRotateSizeAddr); err != nil {
+		return err
+	} else if n <= 0 {
+		return fmt.Errorf("invalid log rotate size %s", *optLogRotateSizeAddr)
+	} else {
+		optLogRotateSize = n
+	}
+	if *optLogKeepAddr < 0 {
+		return fmt.Errorf("invalid log keep %d", *optLogKeepAddr)
+	}
+	optLogKeep = uint(*optLogKeepAddr)
+	optLogCompress = *optLogCompressAddr
 	optVerbose = *optVerboseAddr
 	optDebug = *optDebugAddr
+	optServerAddr = *optServerAddrAddr
+	optAgentAddr = *optAgentAddrAddr
+	optConfig = *optConfigAddr
+	optProfile = *optProfileAddr
+	if len(optProfile) != 0 && len(optConfig) == 0 {
+		return fmt.Errorf("-profile requires -config")
+	}
+	optDumpConfig = *optDumpConfigAddr
+	optScenario = *optScenarioAddr
+	optSweep = *optSweepAddr
+	optSweepCsv = *optSweepCsvAddr
+	if len(optSweepCsv) != 0 && len(optSweep) == 0 {
+		return fmt.Errorf("-sweep_csv requires -sweep")
+	}
+	optCoordinatorAgents = nil
+	if s := *optCoordinatorAgentsAddr; len(s) != 0 {
+		for _, x := range strings.Split(s, ",") {
+			if len(x) == 0 {
+				return fmt.Errorf("empty agent address in %s", s)
+			}
+			optCoordinatorAgents = append(optCoordinatorAgents, x)
+		}
+	}
+
+	return nil
+}
+
+// options which only make sense per process
+var processOptions = []string{
+	"debug",
+	"server_addr",
+	"agent_addr",
+	"coordinator_agents",
+	"config",
+	"profile",
+	"dump_config",
+	"scenario",
+	"replay",
+	"strace_import",
+	"strace_output",
+	"strace_root",
+	"sweep",
+	"sweep_csv",
+	"flist_file_create",
+	"clean_write_paths",
+	"v",
+	"h",
+}
+
+func isProcessOption(name string) bool {
+	for _, x := range processOptions {
+		if name == x {
+			return true
+		}
+	}
+	return false
+}
+
+// getOptions returns current flag values by name.
+func getOptions() map[string]string {
+	m := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		m[f.Name] = f.Value.String()
+	})
+	return m
+}
+
+// setOptions sets flag values by name, and then reloads option variables.
+func setOptions(m map[string]string) error {
+	for k, v := range m {
+		if err := flag.Set(k, v); err != nil {
+			return fmt.Errorf("option \"%s\": %s", k, err)
+		}
+	}
+	return parseOptions()
+}
+
+// setupInput converts input paths into absolute directory paths.
+func setupInput(args []string) ([]string, error) {
+	// only allow directories since now that write is supported
+	var input []string
+	for _, f := range args {
+		absf, err := filepath.Abs(f)
+		if err != nil {
+			return nil, err
+		}
+		assert(!strings.HasSuffix(absf, "/"))
+		if t, err := getRawFileType(absf); err != nil {
+			return nil, err
+		} else if t != typeDir {
+			return nil, fmt.Errorf("%s not directory", absf)
+		}
+		if !optForce {
+			count := 0
+			for _, x := range absf {
+				if x == '/' {
+					count++
+				}
+			}
+			// /path/to/dir is allowed, but /path/to is not
+			if count < 3 {
+				return nil, fmt.Errorf("%s not allowed, use -force option to proceed", absf)
+			}
+		}
+		input = append(input, absf)
+	}
+	return input, nil
+}
+
+func printSetResult(numInterrupted int, numError int, numRemain int, tsv []threadStat) {
+	if numInterrupted > 0 {
+		var s string
+		if numInterrupted > 1 {
+			s = "s"
+		}
+		fmt.Printf("%d worker%s interrupted\n", numInterrupted, s)
+	}
+	if numError > 0 {
+		var s string
+		if numError > 1 {
+			s = "s"
+		}
+		fmt.Printf("%d worker%s failed\n", numError, s)
+	}
+	if numRemain > 0 {
+		var s string
+		if numRemain > 1 {
+			s = "s"
+		}
+		fmt.Printf("%d write path%s remaining\n", numRemain, s)
+	}
+	printStat(tsv)
+	printDataStat(tsv)
+	printFlushStat(tsv)
+	printCopyStat(tsv)
+	printExtentStat(tsv)
+	if optPersonality != nil {
+		printPersonalityStat(tsv)
+	}
+}
+
+// runSets dispatches workers optNumSet times unless interrupted.
+func runSets(input []string) ([]setResult, error) {
+	var rv []setResult
+	for i := uint(0); i < optNumSet; i++ {
+		if optNumSet != 1 {
+			fmt.Println(strings.Repeat("=", 80))
+			s := fmt.Sprintf("Set %d/%d", i+1, optNumSet)
+			fmt.Println(s)
+			dbg(s)
+		}
+		seed := initSeed(i)
+		fmt.Println("Seed", seed)
+		numComplete, numInterrupted, numError, numRemain, tsv, err := dispatch(input)
+		if err != nil {
+			return rv, err
+		}
+		printSetResult(numInterrupted, numError, numRemain, tsv)
+		rv = append(rv, setResult{
+			Seed:           seed,
+			NumComplete:    numComplete,
+			NumInterrupted: numInterrupted,
+			NumError:       numError,
+			NumRemain:      numRemain,
+			Stats:          tsv,
+		})
+		if numInterrupted > 0 {
+			break
+		} else if optNumSet != 1 && i != optNumSet-1 {
+			fmt.Println()
+		}
+	}
+	return rv, nil
+}
+
+func main() {
+	progname := path.Base(os.Args[0])
+
+	flag.Parse()
+	args := flag.Args()
+	if err := parseOptions(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if len(optConfig) != 0 {
+		paths, err := applyConfig(optConfig, optProfile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if len(args) == 0 {
+			args = paths
+		}
+		if err := parseOptions(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if err := initProcess(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
 	if *optVersionAddr {
 		printVersion()
@@ -241,7 +881,24 @@ func main() {
 		os.Exit(1)
 	}
 
-	if len(args) < 1 {
+	if optDumpConfig {
+		if err := printConfig(args); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// convert strace output and exit
+	if len(optStraceImport) != 0 {
+		if err := runStraceImport(optStraceImport, optStraceOutput, optStraceRoot); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if len(args) < 1 && len(optServerAddr) == 0 && len(optAgentAddr) == 0 {
 		usage(progname)
 		os.Exit(1)
 	}
@@ -270,36 +927,58 @@ func main() {
 		dbgf("option \"%s\" -> %s\n", f.Name, f.Value)
 	})
 
-	// only allow directories since now that write is supported
-	var input []string
-	for _, f := range args {
-		absf, err := filepath.Abs(f)
+	// run as child process of dispatchProcess if specified
+	if isChildProcess() {
+		input, err := setupInput(args)
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
-		assert(!strings.HasSuffix(absf, "/"))
-		if t, err := getRawFileType(absf); err != nil {
+		if err := runChild(input); err != nil {
 			fmt.Println(err)
 			os.Exit(1)
-		} else if t != typeDir {
-			fmt.Println(absf, "not directory")
+		}
+		os.Exit(0)
+	}
+
+	// run as server, agent or coordinator if specified
+	numMode := 0
+	for _, b := range []bool{len(optServerAddr) != 0, len(optAgentAddr) != 0,
+		len(optCoordinatorAgents) != 0} {
+		if b {
+			numMode++
+		}
+	}
+	if numMode > 1 {
+		fmt.Println("-server_addr, -agent_addr and -coordinator_agents are exclusive")
+		os.Exit(1)
+	}
+	if len(optServerAddr) != 0 {
+		if err := runServer(optServerAddr); err != nil {
+			fmt.Println(err)
 			os.Exit(1)
 		}
-		if !optForce {
-			count := 0
-			for _, x := range absf {
-				if x == '/' {
-					count++
-				}
-			}
-			// /path/to/dir is allowed, but /path/to is not
-			if count < 3 {
-				fmt.Println(absf, "not allowed, use -force option to proceed")
-				os.Exit(1)
-			}
+		os.Exit(0)
+	}
+	if len(optAgentAddr) != 0 {
+		if err := runAgent(optAgentAddr); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
 		}
-		input = append(input, absf)
+		os.Exit(0)
+	}
+	if len(optCoordinatorAgents) != 0 {
+		if err := runCoordinator(optCoordinatorAgents, args); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	input, err := setupInput(args)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
 	}
 	dbg("input", input)
 
@@ -333,6 +1012,14 @@ func main() {
 		}
 		os.Exit(0)
 	}
+	// populate input directories and exit
+	if optPopulate {
+		if err := runPopulate(input); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 	// clean write paths and exit
 	if optCleanWritePaths {
 		if l, err := collectWritePaths(input); err != nil {
@@ -351,46 +1038,36 @@ func main() {
 		os.Exit(0)
 	}
 
-	// ready to dispatch workers
-	for i := uint(0); i < optNumSet; i++ {
-		if optNumSet != 1 {
-			fmt.Println(strings.Repeat("=", 80))
-			s := fmt.Sprintf("Set %d/%d", i+1, optNumSet)
-			fmt.Println(s)
-			dbg(s)
-		}
-		rand.Seed(time.Now().UnixNano())
-		_, numInterrupted, numError, numRemain, tsv, err := dispatchWorker(input)
-		if err != nil {
+	// run phases in scenario file and exit
+	if len(optScenario) != 0 {
+		if err := runScenario(optScenario, input); err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
-		if numInterrupted > 0 {
-			var s string
-			if numInterrupted > 1 {
-				s = "s"
-			}
-			fmt.Printf("%d worker%s interrupted\n", numInterrupted, s)
-		}
-		if numError > 0 {
-			var s string
-			if numError > 1 {
-				s = "s"
-			}
-			fmt.Printf("%d worker%s failed\n", numError, s)
-		}
-		if numRemain > 0 {
-			var s string
-			if numRemain > 1 {
-				s = "s"
-			}
-			fmt.Printf("%d write path%s remaining\n", numRemain, s)
+		os.Exit(0)
+	}
+
+	// replay trace file and exit
+	if len(optReplay) != 0 {
+		if err := runReplay(optReplay, input); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
 		}
-		printStat(tsv)
-		if numInterrupted > 0 {
-			break
-		} else if optNumSet != 1 && i != optNumSet-1 {
-			fmt.Println()
+		os.Exit(0)
+	}
+
+	// run each combination of option values and exit
+	if len(optSweep) != 0 {
+		if err := runSweep(optSweep, input); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
 		}
+		os.Exit(0)
+	}
+
+	// ready to dispatch workers
+	if _, err := runSets(input); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
 	}
 }
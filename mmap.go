@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+const (
+	accessSyscall = iota
+	accessMmap
+)
+
+// readFileMmap reads fp by copying slices of a shared mapping to the read
+// buffer, so that each page is faulted in. resid < 0 means whole file.
+func readFileMmap(fp *os.File, resid int64, thr *gThread) error {
+	st, err := fp.Stat()
+	if err != nil {
+		return err
+	}
+	siz := st.Size()
+	if resid >= 0 && resid < siz {
+		siz = resid
+	}
+	if siz == 0 {
+		return nil
+	}
+
+	t := time.Now()
+	m, err := mmapFile(fp, 0, int(siz), false)
+	traceOp(thr, "mmap", fp.Name(), 0, siz, err, t)
+	if err != nil {
+		return err
+	}
+	defer munmapFile(m)
+
+	b := thr.dir.readBuffer
+	for off := int64(0); off < siz; {
+		t := time.Now()
+		n := copy(b, m[off:])
+		thr.stat.addReadLatency(time.Since(t))
+		traceOp(thr, "read", fp.Name(), off, int64(n), nil, t)
+		thr.stat.incNumRead()
+		thr.stat.addNumReadBytes(n)
+		off += int64(n)
+	}
+	return nil
+}
+
+// writeDataMmap extends fp by resid bytes, and writes them through a shared
+// mapping followed by msync(2).
+func writeDataMmap(fp *os.File, resid int64, thr *gThread) error {
+	assert(resid > 0)
+	st, err := fp.Stat()
+	if err != nil {
+		return err
+	}
+	off := st.Size()
+
+	t := time.Now()
+	err = fp.Truncate(off + resid)
+	traceOp(thr, "truncate", fp.Name(), 0, off+resid, err, t)
+	if err != nil {
+		return err
+	}
+
+	// mapping offset must be page aligned
+	pageOff := off &^ int64(os.Getpagesize()-1)
+	t = time.Now()
+	m, err := mmapFile(fp, pageOff, int(off+resid-pageOff), true)
+	traceOp(thr, "mmap", fp.Name(), pageOff, off+resid-pageOff, err, t)
+	if err != nil {
+		return err
+	}
+	defer munmapFile(m)
+
+	b := thr.dir.writeBuffer
+	for i := off - pageOff; i < int64(len(m)); {
+		x := b
+		if int64(len(x)) > int64(len(m))-i {
+			x = x[:int64(len(m))-i]
+		}
+		fillWriteData(x, thr)
+		t := time.Now()
+		n := copy(m[i:], x)
+		d := time.Since(t)
+		traceOp(thr, "write", fp.Name(), pageOff+i, int64(n), nil, t)
+		thr.stat.incNumWrite()
+		thr.stat.addWriteLatency(d)
+		thr.stat.addNumWriteBytes(n)
+		i += int64(n)
+	}
+
+	t = time.Now()
+	err = msyncFile(m)
+	traceOp(thr, "msync", fp.Name(), pageOff, int64(len(m)), err, t)
+	if err != nil {
+		return err
+	}
+	thr.stat.addFlushLatency(flushMsync, time.Since(t))
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build !linux && !darwin && !freebsd
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// mmapSupported is false where mmap is unavailable, -access_method=mmap is
+// rejected.
+const mmapSupported = false
+
+func mmapFile(fp *os.File, off int64, n int, write bool) ([]byte, error) {
+	return nil, fmt.Errorf("mmap unsupported")
+}
+
+func munmapFile(b []byte) error {
+	return fmt.Errorf("munmap unsupported")
+}
+
+func msyncFile(b []byte) error {
+	return fmt.Errorf("msync unsupported")
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_writeDataMmap(t *testing.T) {
+	if !mmapSupported {
+		t.Skip("mmap unsupported")
+	}
+	f := filepath.Join(t.TempDir(), "x")
+	head := bytes.Repeat([]byte{0x42}, 5000)
+	if err := os.WriteFile(f, head, 0644); err != nil {
+		t.Error(err)
+		return
+	}
+
+	fp, err := os.OpenFile(f, os.O_RDWR, 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer fp.Close()
+	thr := newWrite(0, 1024)
+	if err := writeDataMmap(fp, 6000, &thr); err != nil {
+		t.Error(err)
+		return
+	}
+	if thr.stat.numWriteBytes != 6000 || thr.stat.numWrite != 6 {
+		t.Error(thr.stat.numWriteBytes, thr.stat.numWrite)
+	}
+	if n := thr.stat.flushLatency[flushMsync].Count; n != 1 {
+		t.Error(n)
+	}
+
+	b, err := os.ReadFile(f)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(b) != 11000 || !bytes.Equal(b[:5000], head) {
+		t.Error(len(b))
+	}
+
+	readList := []struct {
+		resid int64
+		n     uint64
+	}{
+		{-1, 11000},
+		{4096, 4096},
+		{20000, 11000},
+	}
+	for _, x := range readList {
+		thr := newRead(0, 1024)
+		if err := readFileMmap(fp, x.resid, &thr); err != nil {
+			t.Error(x, err)
+		}
+		if thr.stat.numReadBytes != x.n {
+			t.Error(x, thr.stat.numReadBytes)
+		}
+	}
+}
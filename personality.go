@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// personality emulates a workload of a specific application on top of
+// reader and writer Goroutines.
+type personality struct {
+	name   string
+	opName string // plural form of operation name
+	entry  func(string, *gThread) error
+	finish func(*gThread) error
+	index  func([]string, *gThread) int // select flist index if not nil
+}
+
+var personalityList = []personality{
+	{"maildir", "messages", maildirEntry, maildirFinish, nil},
+	{"db", "commits", dbEntry, dbFinish, nil},
+	{"web", "requests", webEntry, nil, webIndex},
+	{"build", "objects", buildEntry, nil, nil},
+	{"logwriter", "records", logWriterEntry, logWriterFinish, nil},
+}
+
+func getPersonality(name string) (*personality, error) {
+	var l []string
+	for i := range personalityList {
+		if personalityList[i].name == name {
+			return &personalityList[i], nil
+		}
+		l = append(l, personalityList[i].name)
+	}
+	return nil, fmt.Errorf("invalid personality %s, expected [%s]",
+		name, strings.Join(l, "|"))
+}
+
+func getPersonalityNames() string {
+	var l []string
+	for i := range personalityList {
+		l = append(l, personalityList[i].name)
+	}
+	return strings.Join(l, "|")
+}
+
+func processEntry(f string, thr *gThread) error {
+	if optPersonality != nil {
+		return optPersonality.entry(f, thr)
+	}
+	if thr.isReader() {
+		return readEntry(f, thr)
+	} else {
+		return writeEntry(f, thr)
+	}
+}
+
+// finishEntry is called when a worker exits.
+func finishEntry(thr *gThread) error {
+	if optPersonality != nil && optPersonality.finish != nil {
+		return optPersonality.finish(thr)
+	}
+	return nil
+}
+
+func getLatencyString(d time.Duration) string {
+	return fmt.Sprintf("%.2fus", float64(d)/float64(time.Microsecond))
+}
+
+func printPersonalityStat(tsv []threadStat) {
+	assert(optPersonality != nil)
+	numOp := uint64(0)
+	numOpSec := 0.0
+	var lat latencyStat
+	for i := 0; i < len(tsv); i++ {
+		numOp += tsv[i].numOp
+		if sec := tsv[i].timeEnd.Sub(tsv[i].timeBegin).Seconds(); sec > 0 {
+			numOpSec += float64(tsv[i].numOp) / sec
+		}
+		lat.merge(&tsv[i].opLatency)
+	}
+
+	s := optPersonality.opName
+	fmt.Printf("%s: %d %s %.2f %s/sec latency avg %s p50 %s p99 %s max %s\n",
+		optPersonality.name, numOp, s, numOpSec, s,
+		getLatencyString(lat.mean()), getLatencyString(lat.percentile(50)),
+		getLatencyString(lat.percentile(99)), getLatencyString(time.Duration(lat.Max)))
+
+	// per size bucket if any
+	var sizeLat []latencyStat
+	for i := 0; i < len(tsv); i++ {
+		if x := tsv[i].opSizeLatency; x != nil {
+			if sizeLat == nil {
+				sizeLat = make([]latencyStat, len(x))
+			}
+			for j := 0; j < len(x) && j < len(sizeLat); j++ {
+				sizeLat[j].merge(&x[j])
+			}
+		}
+	}
+	for i := range sizeLat {
+		if sizeLat[i].Count == 0 {
+			continue
+		}
+		var b string
+		if i < len(opSizeBucketList) {
+			b = "<" + formatSize(opSizeBucketList[i])
+		} else {
+			b = ">=" + formatSize(opSizeBucketList[len(opSizeBucketList)-1])
+		}
+		x := &sizeLat[i]
+		fmt.Printf("  %-6s %d %s latency avg %s p50 %s p99 %s max %s\n",
+			b, x.Count, s,
+			getLatencyString(x.mean()), getLatencyString(x.percentile(50)),
+			getLatencyString(x.percentile(99)), getLatencyString(time.Duration(x.Max)))
+	}
+}
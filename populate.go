@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// populateFile is a file to create by populate.
+type populateFile struct {
+	path string
+	size int64
+}
+
+// getPopulateDir returns a leaf directory for i'th of numLeaf leaves, which
+// are spread evenly over fanout^depth leaf directories, e.g. d1/d3 for i=7
+// of 16 leaves and d2/d0 for i=1 of 2 leaves with fan-out 4 and depth 2.
+// Each level is a digit of i/numLeaf in base fanout by long division, so
+// that it never overflows with deep directories.
+func getPopulateDir(i uint, numLeaf uint, depth uint, fanout uint) string {
+	assert(i < numLeaf)
+	l := make([]string, depth)
+	for j := range l {
+		i *= fanout
+		l[j] = "d" + strconv.Itoa(int(i/numLeaf))
+		i %= numLeaf
+	}
+	return filepath.Join(l...)
+}
+
+// getNumPopulateLeaf returns number of leaf directories, which is at most
+// number of files.
+func getNumPopulateLeaf(numFile uint, depth uint, fanout uint) uint {
+	n := uint(1)
+	for i := uint(0); i < depth; i++ {
+		n *= fanout
+		if n >= numFile {
+			return numFile
+		}
+	}
+	return n
+}
+
+// getPopulateFiles returns files to create under input with sizes sampled
+// by r, which are the same for the same seed and options.
+func getPopulateFiles(input string, r *rand.Rand) []populateFile {
+	numLeaf := getNumPopulateLeaf(optPopulateFiles, optPopulateDepth,
+		optPopulateFanout)
+	var l []populateFile
+	for i := uint(0); i < optPopulateFiles; i++ {
+		d := getPopulateDir(i%numLeaf, numLeaf, optPopulateDepth,
+			optPopulateFanout)
+		l = append(l, populateFile{
+			path: filepath.Join(input, d, fmt.Sprintf("f%d", i)),
+			size: optPopulateFileSize.sample(r),
+		})
+	}
+	return l
+}
+
+// populateDir is os.MkdirAll with each mkdir recorded to trace file.
+func populateDir(d string, thr *gThread) error {
+	if _, err := os.Lstat(d); err == nil {
+		return nil
+	}
+	if err := populateDir(filepath.Dir(d), thr); err != nil {
+		return err
+	}
+	if err := traceMkdir(d, 0755, thr); err != nil && !os.IsExist(err) {
+		return err
+	}
+	return nil
+}
+
+// populateFileImpl creates a file unless it already exists, and returns
+// false if it exists, so that existing files are never overwritten.
+func populateFileImpl(x *populateFile, thr *gThread) (bool, error) {
+	t := time.Now()
+	fp, err := os.OpenFile(x.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	traceOp(thr, "create", x.path, 0, 0, err, t)
+	if err != nil {
+		if os.IsExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer fp.Close()
+	if x.size > 0 {
+		if err := writeData(fp, x.size, thr); err != nil {
+			return false, err
+		}
+	}
+	if optFsyncWritePaths {
+		if err := traceFlush(fp, thr); err != nil {
+			return false, err
+		}
+	}
+	return true, fp.Close()
+}
+
+// runPopulate creates files under each input in parallel by -num_writer
+// Goroutines, or number of CPUs if unspecified.
+func runPopulate(input []string) error {
+	seed := initSeed(0)
+	fmt.Println("Seed", seed)
+	initDir()
+
+	var fl []populateFile
+	totalSize := int64(0)
+	for _, f := range input {
+		for _, x := range getPopulateFiles(f, rand.New(rand.NewSource(seed))) {
+			fl = append(fl, x)
+			totalSize += x.size
+		}
+	}
+	numThread := optNumWriter
+	if numThread == 0 {
+		numThread = uint(runtime.NumCPU())
+	}
+	if numThread > uint(len(fl)) {
+		numThread = uint(len(fl))
+	}
+	fmt.Printf("Populate %d files of %s by %d threads\n",
+		len(fl), formatSize(totalSize), numThread)
+	if numThread == 0 {
+		return nil
+	}
+
+	// open trace file if specified
+	if len(optTraceFile) != 0 {
+		if err := openTrace(); err != nil {
+			return err
+		}
+		defer func() {
+			if err := closeTrace(); err != nil {
+				fmt.Println(err)
+			}
+		}()
+	}
+
+	if err := initDirect(input); err != nil {
+		return err
+	}
+	thrv := make([]gThread, numThread)
+	for i := range thrv {
+		thrv[i] = newWrite(uint(i), optWriteBufferSize)
+		thrv[i].stat.setInputPath(input[0])
+	}
+
+	// create directories in advance
+	for i, x := range fl {
+		if d := filepath.Dir(x.path); i == 0 || d != filepath.Dir(fl[i-1].path) {
+			if err := populateDir(d, &thrv[0]); err != nil {
+				return err
+			}
+		}
+	}
+
+	// print progress every second
+	var numDone, numSkip uint64
+	var numDoneBytes int64
+	doneCh := make(chan int)
+	var pwg sync.WaitGroup
+	pwg.Add(1)
+	go func() {
+		defer pwg.Done()
+		tc := time.NewTicker(time.Second)
+		defer tc.Stop()
+		for {
+			select {
+			case <-doneCh:
+				return
+			case <-tc.C:
+				fmt.Printf("Populated %d / %d files, %s / %s\n",
+					atomic.LoadUint64(&numDone), len(fl),
+					formatSize(atomic.LoadInt64(&numDoneBytes)),
+					formatSize(totalSize))
+			}
+		}
+	}()
+
+	// i'th thread creates every numThread'th file, so that contents are
+	// also reproducible with the same number of threads
+	errv := make([]error, numThread)
+	var wg sync.WaitGroup
+	for i := range thrv {
+		thr := &thrv[i]
+		thr.stat.setTimeBegin()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer thr.stat.setTimeEnd()
+			for j := i; j < len(fl); j += int(numThread) {
+				created, err := populateFileImpl(&fl[j], thr)
+				if err != nil {
+					errv[i] = err
+					return
+				}
+				thr.stat.incNumRepeat()
+				atomic.AddUint64(&numDone, 1)
+				if created {
+					atomic.AddInt64(&numDoneBytes, fl[j].size)
+				} else {
+					atomic.AddUint64(&numSkip, 1)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(doneCh)
+	pwg.Wait()
+
+	var tsv []threadStat
+	for i := range thrv {
+		tsv = append(tsv, thrv[i].stat)
+	}
+	printStat(tsv)
+	printDataStat(tsv)
+	printFlushStat(tsv)
+	fmt.Printf("Populated %d / %d files, %s / %s, %d existing files skipped\n",
+		numDone, len(fl), formatSize(numDoneBytes), formatSize(totalSize), numSkip)
+	for _, err := range errv {
+		if err != nil {
+			return err
+		}
+	}
+
+	// write flist as a by-product if specified
+	if len(optFlistFile) != 0 {
+		var l []string
+		for _, x := range fl {
+			l = append(l, x.path)
+		}
+		if err := writeFlistFile(l, optFlistFile, optForce); err != nil {
+			return err
+		}
+		fmt.Println("Created", optFlistFile)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_getPopulateDir(t *testing.T) {
+	dirList := []struct {
+		i       uint
+		numLeaf uint
+		depth   uint
+		fanout  uint
+		d       string
+	}{
+		{0, 1, 0, 4, ""},
+		{0, 4, 1, 4, "d0"},
+		{3, 4, 1, 4, "d3"},
+		{0, 16, 2, 4, "d0/d0"},
+		{7, 16, 2, 4, "d1/d3"},
+		{15, 16, 2, 4, "d3/d3"},
+		{5, 8, 3, 2, "d1/d0/d1"},
+		{1, 2, 2, 4, "d2/d0"},
+		{3, 8, 2, 4, "d1/d2"},
+		{1, 3, 64, 8, strings.Repeat("d2/d5/", 31) + "d2/d5"},
+	}
+	for _, x := range dirList {
+		if d := getPopulateDir(x.i, x.numLeaf, x.depth, x.fanout); d != x.d {
+			t.Error(x, d)
+		}
+	}
+
+	// leaves fewer than fanout^depth are spread over top level directories
+	for _, x := range []struct {
+		numLeaf uint
+		depth   uint
+		fanout  uint
+	}{
+		{8, 2, 8},
+		{16, 2, 8},
+		{20, 3, 8},
+		{100, 3, 10},
+		{100, 64, 8},
+	} {
+		m := make(map[string]bool)
+		count := make(map[string]uint)
+		for i := uint(0); i < x.numLeaf; i++ {
+			d := getPopulateDir(i, x.numLeaf, x.depth, x.fanout)
+			if m[d] {
+				t.Error(x, i, d)
+			}
+			m[d] = true
+			count[strings.SplitN(d, "/", 2)[0]]++
+		}
+		if uint(len(count)) != x.fanout {
+			t.Error(x, count)
+		}
+		for k, n := range count {
+			if n < x.numLeaf/x.fanout || n > (x.numLeaf+x.fanout-1)/x.fanout {
+				t.Error(x, k, n)
+			}
+		}
+	}
+}
+
+func Test_getNumPopulateLeaf(t *testing.T) {
+	leafList := []struct {
+		numFile uint
+		depth   uint
+		fanout  uint
+		n       uint
+	}{
+		{100, 0, 8, 1},
+		{100, 1, 8, 8},
+		{100, 2, 8, 64},
+		{100, 3, 8, 100},
+		{100, 64, 8, 100},
+		{0, 2, 8, 0},
+		{100, 10, 1, 1},
+	}
+	for _, x := range leafList {
+		if n := getNumPopulateLeaf(x.numFile, x.depth, x.fanout); n != x.n {
+			t.Error(x, n)
+		}
+	}
+}
+
+func Test_populateFileImpl(t *testing.T) {
+	d := t.TempDir()
+	thr := newWrite(0, 1024)
+	thr.stat.setInputPath(d)
+
+	x := populateFile{path: filepath.Join(d, "f0"), size: 100}
+	if created, err := populateFileImpl(&x, &thr); err != nil || !created {
+		t.Fatal(created, err)
+	}
+	if st, err := os.Stat(x.path); err != nil || st.Size() != x.size {
+		t.Error(st, err)
+	}
+
+	// existing file is not overwritten
+	if err := os.WriteFile(x.path, []byte("xxx"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if created, err := populateFileImpl(&x, &thr); err != nil || created {
+		t.Error(created, err)
+	}
+	if b, err := os.ReadFile(x.path); err != nil || string(b) != "xxx" {
+		t.Error(string(b), err)
+	}
+
+	x = populateFile{path: filepath.Join(d, "noent", "f1"), size: 100}
+	if created, err := populateFileImpl(&x, &thr); err == nil || created {
+		t.Error(created, err)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+const childProcessEnv = "DIRLOAD_CHILD_PROCESS"
+
+var (
+	childIndex = -1
+)
+
+// childReport is sent from a child process to the parent process via fd 3.
+type childReport struct {
+	Result     setResult `json:"result"`
+	WritePaths []string  `json:"write_paths"`
+}
+
+func initProcess() error {
+	s := os.Getenv(childProcessEnv)
+	if len(s) == 0 {
+		return nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	if n < 0 || uint(n) >= optNumProcess {
+		return fmt.Errorf("invalid child process index %d", n)
+	}
+	childIndex = n
+	return nil
+}
+
+func isChildProcess() bool {
+	return childIndex != -1
+}
+
+func isProcessThread(gid uint) bool {
+	if !isChildProcess() {
+		return true
+	}
+	return gid%optNumProcess == uint(childIndex)
+}
+
+func dispatch(input []string) (int, int, int, int, []threadStat, error) {
+	if optNumProcess > 1 && !isChildProcess() {
+		return dispatchProcess(input)
+	}
+	return dispatchWorker(input)
+}
+
+func runChild(input []string) error {
+	fp := os.NewFile(3, "report")
+	if fp == nil {
+		return fmt.Errorf("no report pipe")
+	}
+	defer fp.Close()
+
+	seed := initSeed(0)
+	numComplete, numInterrupted, numError, numRemain, tsv, err := dispatchWorker(input)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(fp).Encode(childReport{
+		Result: setResult{
+			Seed:           seed,
+			NumComplete:    numComplete,
+			NumInterrupted: numInterrupted,
+			NumError:       numError,
+			NumRemain:      numRemain,
+			Stats:          tsv,
+		},
+		WritePaths: keptWritePaths,
+	})
+}
+
+// getChildArgs returns effective options and input as child arguments,
+// as options may have been given by other than command line.
+func getChildArgs(input []string) []string {
+	var args []string
+	for k, v := range getOptions() {
+		if k == "seed" {
+			v = fmt.Sprint(workerSeed) // reproduce parent's seed
+		}
+		if !isProcessOption(k) || k == "debug" {
+			args = append(args, fmt.Sprintf("-%s=%s", k, v))
+		}
+	}
+	sort.Strings(args)
+	return append(args, input...)
+}
+
+func dispatchProcess(input []string) (int, int, int, int, []threadStat, error) {
+	keptWritePaths = nil
+
+	// number of readers and writers are 0 by default
+	numThread := optNumReader + optNumWriter
+	if numThread == 0 {
+		return 0, 0, 0, 0, nil, nil
+	}
+	numProcess := optNumProcess
+	if numProcess > numThread {
+		numProcess = numThread
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return -1, -1, -1, -1, nil, err
+	}
+
+	// children run in own process group to receive SIGINT only from parent
+	var cmdv []*exec.Cmd
+	var fpv []*os.File
+	defer func() {
+		for _, fp := range fpv {
+			fp.Close()
+		}
+	}()
+	for i := uint(0); i < numProcess; i++ {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return -1, -1, -1, -1, nil, err
+		}
+		fpv = append(fpv, r)
+		cmd := exec.Command(exe, getChildArgs(input)...)
+		cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%d", childProcessEnv, i))
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.ExtraFiles = []*os.File{w}
+		setChildProcAttr(cmd)
+		err = cmd.Start()
+		w.Close()
+		if err != nil {
+			return -1, -1, -1, -1, nil, err
+		}
+		dbgf("child %d pid %d", i, cmd.Process.Pid)
+		cmdv = append(cmdv, cmd)
+	}
+
+	// forward SIGINT to children
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT)
+	defer signal.Stop(ch)
+	doneCh := make(chan int)
+	var swg sync.WaitGroup
+	swg.Add(1)
+	go func() {
+		defer swg.Done()
+		select {
+		case <-doneCh:
+		case s := <-ch:
+			dbg("signal", s)
+			for _, cmd := range cmdv {
+				if err := cmd.Process.Signal(syscall.SIGINT); err != nil {
+					dbg(err)
+				}
+			}
+		}
+	}()
+
+	rv := make([]childReport, len(cmdv))
+	ev := make([]error, len(cmdv))
+	var wg sync.WaitGroup
+	for i := range cmdv {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := json.NewDecoder(fpv[i]).Decode(&rv[i]); err != nil {
+				ev[i] = fmt.Errorf("child %d: %s", i, err)
+			}
+			if err := cmdv[i].Wait(); err != nil && ev[i] == nil {
+				ev[i] = fmt.Errorf("child %d: %s", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(doneCh)
+	swg.Wait()
+
+	// collect result, children ran gid % numProcess
+	var numComplete, numInterrupted, numError int
+	var writePaths []string
+	for i := range rv {
+		numComplete += rv[i].Result.NumComplete
+		numInterrupted += rv[i].Result.NumInterrupted
+		numError += rv[i].Result.NumError
+		writePaths = append(writePaths, rv[i].WritePaths...)
+	}
+	var tsv []threadStat
+	for i := uint(0); i < numThread; i++ {
+		l := rv[i%numProcess].Result.Stats
+		if j := i / numProcess; j < uint(len(l)) {
+			tsv = append(tsv, l[j])
+		}
+	}
+
+	// cleanup write paths even if some children failed
+	keptWritePaths = writePaths
+	if !optKeepWritePaths {
+		if l, err := unlinkWritePaths(writePaths, -1); err != nil {
+			return -1, -1, -1, -1, nil, err
+		} else {
+			keptWritePaths = l
+		}
+	}
+	for _, err := range ev {
+		if err != nil {
+			return -1, -1, -1, -1, nil, err
+		}
+	}
+	return numComplete, numInterrupted, numError, len(keptWritePaths), tsv, nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd
+
+package main
+
+import (
+	"os/exec"
+)
+
+// setChildProcAttr does nothing where process group is unavailable.
+func setChildProcAttr(cmd *exec.Cmd) {
+}
@@ -0,0 +1,14 @@
+//go:build linux || darwin || freebsd
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setChildProcAttr puts a child in its own process group, so that SIGINT
+// from terminal is forwarded by the parent instead of delivered directly.
+func setChildProcAttr(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
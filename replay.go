@@ -0,0 +1,567 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// replayThread replays records of a gid in order.
+type replayThread struct {
+	gid     uint // gid in trace file
+	input   string
+	recs    []traceRecord
+	buf     []byte
+	stat    threadStat
+	created map[string]bool // paths created by replay
+	dir     threadDir
+	numDone uint
+	numFail uint
+	numSkip uint // records failed in trace
+}
+
+// Field names accepted for generic JSONL traces, the first one is used
+// by -trace_file.
+var (
+	traceTsKeys      = []string{"ts", "timestamp", "time"}
+	traceGidKeys     = []string{"gid", "tid", "thread", "pid"}
+	traceOpKeys      = []string{"op", "syscall", "operation"}
+	tracePathKeys    = []string{"path", "file", "filename"}
+	traceNewPathKeys = []string{"new_path", "dst", "target"}
+	traceOffsetKeys  = []string{"offset", "off", "pos"}
+	traceSizeKeys    = []string{"size", "len", "length", "bytes"}
+	traceResultKeys  = []string{"result"}
+)
+
+func getTraceValue(m map[string]interface{}, keys []string) (interface{}, bool) {
+	for _, k := range keys {
+		if v, ok := m[k]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func getTraceString(m map[string]interface{}, keys []string) (string, error) {
+	v, ok := getTraceValue(m, keys)
+	if !ok {
+		return "", nil
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid %s value %v", keys[0], v)
+}
+
+func getTraceInt(m map[string]interface{}, keys []string) (int64, error) {
+	v, ok := getTraceValue(m, keys)
+	if !ok {
+		return 0, nil
+	}
+	switch x := v.(type) {
+	case float64:
+		return int64(x), nil
+	case string:
+		return strconv.ParseInt(x, 10, 64)
+	default:
+		return 0, fmt.Errorf("invalid %s value %v", keys[0], v)
+	}
+}
+
+// getTraceTime accepts RFC3339 string or unix time in seconds.
+func getTraceTime(m map[string]interface{}, keys []string) (time.Time, error) {
+	v, ok := getTraceValue(m, keys)
+	if !ok {
+		return time.Time{}, nil
+	}
+	switch x := v.(type) {
+	case float64:
+		sec, frac := math.Modf(x)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	case string:
+		return time.Parse(time.RFC3339Nano, x)
+	default:
+		return time.Time{}, fmt.Errorf("invalid %s value %v", keys[0], v)
+	}
+}
+
+// parseTraceLine parses a line of dirload or generic JSONL trace.
+func parseTraceLine(b []byte) (traceRecord, error) {
+	var x traceRecord
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return x, err
+	}
+
+	var err error
+	if x.Ts, err = getTraceTime(m, traceTsKeys); err != nil {
+		return x, err
+	}
+	if n, err := getTraceInt(m, traceGidKeys); err != nil {
+		return x, err
+	} else if n < 0 {
+		return x, fmt.Errorf("invalid gid %d", n)
+	} else {
+		x.Gid = uint(n)
+	}
+	if x.Op, err = getTraceString(m, traceOpKeys); err != nil {
+		return x, err
+	} else if len(x.Op) == 0 {
+		return x, fmt.Errorf("no op")
+	}
+	if x.Path, err = getTraceString(m, tracePathKeys); err != nil {
+		return x, err
+	} else if len(x.Path) == 0 {
+		return x, fmt.Errorf("no path")
+	}
+	if x.NewPath, err = getTraceString(m, traceNewPathKeys); err != nil {
+		return x, err
+	}
+	if x.Offset, err = getTraceInt(m, traceOffsetKeys); err != nil {
+		return x, err
+	}
+	if x.Size, err = getTraceInt(m, traceSizeKeys); err != nil {
+		return x, err
+	}
+	if x.Result, err = getTraceString(m, traceResultKeys); err != nil {
+		return x, err
+	}
+	return x, nil
+}
+
+// isTraceFailed returns true if the record failed in the traced run,
+// records without result are considered successful.
+func isTraceFailed(x *traceRecord) bool {
+	return len(x.Result) != 0 && x.Result != traceResultOk
+}
+
+func loadTraceFile(f string) ([]traceRecord, error) {
+	fp, err := os.Open(f)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	var l []traceRecord
+	scanner := bufio.NewScanner(fp)
+	scanner.Buffer(make([]byte, 1<<16), 1<<20)
+	for i := 1; scanner.Scan(); i++ {
+		b := scanner.Bytes()
+		if len(b) == 0 {
+			continue
+		}
+		x, err := parseTraceLine(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", f, i, err)
+		}
+		l = append(l, x)
+	}
+	return l, scanner.Err()
+}
+
+// getReplayPath rebases a path in trace on input path, the result never
+// goes outside the input path.
+func getReplayPath(input string, f string) string {
+	return filepath.Join(input, filepath.Join("/", f))
+}
+
+func isReplayWriteOp(op string) bool {
+	switch op {
+	case "stat", "readlink", "read", "mmap", "open", "close":
+		return false
+	default:
+		return true
+	}
+}
+
+func (this *replayThread) readAt(f string, off int64, siz int64) error {
+	fp, err := os.Open(f)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	if off < 0 {
+		off = 0
+	}
+	for siz > 0 {
+		b := this.buf
+		if int64(len(b)) > siz {
+			b = b[:siz]
+		}
+		t := time.Now()
+		n, err := fp.ReadAt(b, off)
+		this.stat.addReadLatency(time.Since(t))
+		this.stat.incNumRead()
+		this.stat.addNumReadBytes(n)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		off += int64(n)
+		siz -= int64(n)
+	}
+	return nil
+}
+
+func (this *replayThread) writeAt(f string, off int64, siz int64) error {
+	flags := os.O_WRONLY | os.O_CREATE
+	if off < 0 {
+		flags |= os.O_APPEND
+	}
+	fp, err := os.OpenFile(f, flags, 0644)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	for siz > 0 {
+		b := this.buf
+		if int64(len(b)) > siz {
+			b = b[:siz]
+		}
+		t := time.Now()
+		var n int
+		if off < 0 {
+			n, err = fp.Write(b)
+		} else {
+			n, err = fp.WriteAt(b, off)
+			off += int64(n)
+		}
+		if err != nil {
+			return err
+		}
+		this.stat.incNumWrite()
+		this.stat.addWriteLatency(time.Since(t))
+		this.stat.addNumWriteBytes(n)
+		siz -= int64(n)
+	}
+	return fp.Close()
+}
+
+// create creates f if it doesn't exist, as O_CREAT open in trace also
+// succeeds on an existing file. Only a newly created file is tracked.
+func (this *replayThread) create(f string) error {
+	fp, err := os.OpenFile(f, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	this.created[f] = true
+	return fp.Close()
+}
+
+func (this *replayThread) sync(f string, data bool) error {
+	fp, err := os.Open(f)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	if data {
+		return fdatasync(fp)
+	}
+	return fp.Sync()
+}
+
+func (this *replayThread) syncRange(f string, off int64, siz int64) error {
+	fp, err := os.OpenFile(f, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	return syncFileRange(fp, off, siz)
+}
+
+func (this *replayThread) copy(f string, newf string) error {
+	src, err := os.Open(f)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(newf, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	_, n, err := copyFileImpl(dst, src, optCopyMethod, this.buf)
+	this.stat.addNumWriteBytes(int(n))
+	if err != nil {
+		return err
+	}
+	return dst.Close()
+}
+
+func (this *replayThread) fallocate(f string, op string, off int64, siz int64) error {
+	fp, err := os.OpenFile(f, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	for i := range extentFallocate {
+		if x := &extentFallocate[i]; x.op == op {
+			return fallocate(fp, x.mode, off, siz)
+		}
+	}
+	assert(false)
+	return nil
+}
+
+// replayOp re-issues an operation in trace.
+func (this *replayThread) replayOp(x *traceRecord) error {
+	f := getReplayPath(this.input, x.Path)
+	newf := ""
+	if len(x.NewPath) != 0 {
+		newf = getReplayPath(this.input, x.NewPath)
+	}
+
+	switch x.Op {
+	case "stat":
+		this.stat.incNumStat()
+		_, err := os.Lstat(f)
+		return err
+	case "readlink":
+		this.stat.incNumStat()
+		s, err := os.Readlink(f)
+		this.stat.addNumReadBytes(len(s))
+		return err
+	case "read":
+		return this.readAt(f, x.Offset, x.Size)
+	case "write":
+		return this.writeAt(f, x.Offset, x.Size)
+	case "mmap":
+		return nil // reads and writes through mapping are in trace
+	case "open", "close":
+		return nil // each read and write opens the file by itself
+	}
+
+	// below are counted as a write
+	t := time.Now()
+	var err error
+	switch x.Op {
+	case "create":
+		err = this.create(f)
+	case "mkdir":
+		err = os.Mkdir(f, 0755)
+	case "symlink":
+		err = os.Symlink(f, newf)
+	case "link":
+		err = os.Link(f, newf)
+	case "copy":
+		err = this.copy(f, newf)
+	case "rename":
+		err = os.Rename(f, newf)
+	case "unlink":
+		err = os.Remove(f)
+	case "truncate":
+		err = os.Truncate(f, x.Size)
+	case "fallocate", "fallocate_keep_size", "punch_hole", "zero_range",
+		"collapse_range":
+		err = this.fallocate(f, x.Op, x.Offset, x.Size)
+	case "fsync":
+		err = this.sync(f, false)
+	case "fdatasync":
+		err = this.sync(f, true)
+	case "msync":
+		err = this.sync(f, false)
+	case "sync_file_range":
+		err = this.syncRange(f, x.Offset, x.Size)
+	default:
+		return fmt.Errorf("unsupported op %s", x.Op)
+	}
+	this.stat.incNumWrite()
+	this.stat.addWriteLatency(time.Since(t))
+	if err == nil {
+		this.trackPath(x.Op, f, newf)
+	}
+	return err
+}
+
+// trackPath keeps track of paths created by replay, so that they can be
+// cleaned up as write paths. Paths existed before replay are never tracked.
+func (this *replayThread) trackPath(op string, f string, newf string) {
+	switch op {
+	case "mkdir":
+		this.created[f] = true
+	case "symlink", "link", "copy":
+		this.created[newf] = true
+	case "rename":
+		// including children of a directory
+		for x := range this.created {
+			if x == f || strings.HasPrefix(x, f+"/") {
+				delete(this.created, x)
+				this.created[newf+strings.TrimPrefix(x, f)] = true
+			}
+		}
+	case "unlink":
+		delete(this.created, f)
+	}
+}
+
+// setWritePaths registers created paths which still exist as write paths.
+func (this *replayThread) setWritePaths() {
+	for f := range this.created {
+		if exists, _ := pathExists(f); exists {
+			this.dir.writePaths = append(this.dir.writePaths, f)
+		}
+	}
+	sort.Strings(this.dir.writePaths)
+}
+
+func (this *replayThread) run(stopCh <-chan int, begin time.Time, base time.Time) {
+	for i := range this.recs {
+		x := &this.recs[i]
+		// keep original timing scaled by -replay_speed if specified
+		if optReplaySpeed > 0 && !x.Ts.IsZero() && !base.IsZero() {
+			due := time.Duration(float64(x.Ts.Sub(base)) / optReplaySpeed)
+			if d := time.Until(begin.Add(due)); d > 0 {
+				select {
+				case <-stopCh:
+					return
+				case <-time.After(d):
+				}
+			}
+		}
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+		// failed operations are not re-issued, e.g. unlink of a path
+		// which didn't exist may unlink a path which does
+		if isTraceFailed(x) {
+			this.numSkip++
+			this.numDone++
+			continue
+		}
+		if err := this.replayOp(x); err != nil {
+			dbgf("#%d %s", this.gid, err)
+			if optVerbose {
+				fmt.Println(err)
+			}
+			this.numFail++
+		}
+		this.numDone++
+	}
+}
+
+func runReplay(f string, input []string) error {
+	recs, err := loadTraceFile(f)
+	if err != nil {
+		return err
+	}
+	if len(recs) == 0 {
+		return fmt.Errorf("%s: no records", f)
+	}
+
+	// group records by gid in order, and find the earliest timestamp
+	m := make(map[uint][]traceRecord)
+	var base time.Time
+	for _, x := range recs {
+		m[x.Gid] = append(m[x.Gid], x)
+		if !x.Ts.IsZero() && (base.IsZero() || x.Ts.Before(base)) {
+			base = x.Ts
+		}
+	}
+	var gids []uint
+	for gid := range m {
+		gids = append(gids, gid)
+	}
+	sort.Slice(gids, func(i, j int) bool { return gids[i] < gids[j] })
+
+	thrv := make([]replayThread, len(gids))
+	for i, gid := range gids {
+		isReader := true
+		for _, x := range m[gid] {
+			if isReplayWriteOp(x.Op) {
+				isReader = false
+				break
+			}
+		}
+		thr := &thrv[i]
+		thr.gid = gid
+		thr.input = input[gid%uint(len(input))]
+		thr.recs = m[gid]
+		thr.created = make(map[string]bool)
+		thr.buf = make([]byte, maxBufferSize)
+		for j := range thr.buf {
+			thr.buf[j] = 0x41
+		}
+		if isReader {
+			thr.stat = newReadStat()
+		} else {
+			thr.stat = newWriteStat()
+		}
+		thr.stat.setInputPath(thr.input)
+	}
+	fmt.Println("Replay", len(recs), "records of", len(thrv), "threads from", f)
+
+	// stop on SIGINT
+	stopCh := make(chan int)
+	doneCh := make(chan int)
+	go func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGINT)
+		defer signal.Stop(ch)
+		select {
+		case <-ch:
+			dbg("signal")
+			close(stopCh)
+		case <-doneCh:
+		}
+	}()
+
+	var wg sync.WaitGroup
+	begin := time.Now()
+	for i := range thrv {
+		wg.Add(1)
+		thr := &thrv[i]
+		thr.stat.setTimeBegin()
+		go func() {
+			defer wg.Done()
+			thr.run(stopCh, begin, base)
+			thr.stat.setTimeEnd()
+		}()
+	}
+	wg.Wait()
+	close(doneCh)
+
+	var tsv []threadStat
+	numDone := uint(0)
+	numFail := uint(0)
+	numSkip := uint(0)
+	for i := range thrv {
+		tsv = append(tsv, thrv[i].stat)
+		numDone += thrv[i].numDone
+		numFail += thrv[i].numFail
+		numSkip += thrv[i].numSkip
+	}
+	printStat(tsv)
+	fmt.Printf("Replayed %d / %d records, %d failed, %d skipped as failed in trace\n",
+		numDone, len(recs), numFail, numSkip)
+
+	// created paths are removed unless -keep_write_paths
+	var tdv []*threadDir
+	for i := range thrv {
+		thrv[i].setWritePaths()
+		tdv = append(tdv, &thrv[i].dir)
+	}
+	if l, err := cleanupWritePaths(tdv, optKeepWritePaths); err != nil {
+		return err
+	} else if len(l) != 0 {
+		fmt.Println("Kept", len(l), "write paths")
+	}
+	return nil
+}
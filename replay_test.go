@@ -0,0 +1,180 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_parseTraceLine(t *testing.T) {
+	ts := time.Date(2026, 1, 2, 3, 4, 5, 600000000, time.UTC)
+	validList := []struct {
+		s string
+		x traceRecord
+	}{
+		{`{"ts":"2026-01-02T03:04:05.6Z","gid":1,"op":"read","path":"b/f1","offset":7,"size":4096,"result":"ok","duration_ns":100}`,
+			traceRecord{Ts: ts, Gid: 1, Op: "read", Path: "b/f1", Offset: 7, Size: 4096, Result: "ok"}},
+		{`{"op":"unlink","path":"x","result":"no such file or directory"}`,
+			traceRecord{Op: "unlink", Path: "x", Result: "no such file or directory"}},
+		{`{"ts":"2026-01-02T03:04:05.6Z","gid":0,"op":"rename","path":"x","new_path":"y","offset":0,"size":0}`,
+			traceRecord{Ts: ts, Op: "rename", Path: "x", NewPath: "y"}},
+		{`{"op":"write","path":"x","offset":-1,"size":1}`,
+			traceRecord{Op: "write", Path: "x", Offset: -1, Size: 1}},
+		{`{"timestamp":1767323045.5,"tid":3,"syscall":"write","file":"x","pos":"8","len":16}`,
+			traceRecord{Ts: time.Unix(1767323045, 500000000), Gid: 3, Op: "write", Path: "x", Offset: 8, Size: 16}},
+		{`{"time":"2026-01-02T03:04:05.6Z","thread":2,"operation":"symlink","filename":"x","target":"y"}`,
+			traceRecord{Ts: ts, Gid: 2, Op: "symlink", Path: "x", NewPath: "y"}},
+	}
+	for _, x := range validList {
+		if r, err := parseTraceLine([]byte(x.s)); err != nil {
+			t.Error(x.s, err)
+		} else if !r.Ts.Equal(x.x.Ts) || r.Gid != x.x.Gid || r.Op != x.x.Op ||
+			r.Path != x.x.Path || r.NewPath != x.x.NewPath ||
+			r.Offset != x.x.Offset || r.Size != x.x.Size || r.Result != x.x.Result {
+			t.Error(x.s, r)
+		}
+	}
+
+	invalidList := []string{
+		``,
+		`xxx`,
+		`{}`,
+		`{"op":"read"}`,
+		`{"path":"x"}`,
+		`{"op":1,"path":"x"}`,
+		`{"op":"read","path":"x","gid":-1}`,
+		`{"op":"read","path":"x","size":"xxx"}`,
+		`{"op":"read","path":"x","ts":"xxx"}`,
+		`{"op":"read","path":"x","ts":true}`,
+		`{"op":"read","path":"x","result":1}`,
+	}
+	for _, s := range invalidList {
+		if r, err := parseTraceLine([]byte(s)); err == nil {
+			t.Error(s, r)
+		}
+	}
+}
+
+func Test_getReplayPath(t *testing.T) {
+	pathList := []struct {
+		input string
+		f     string
+		x     string
+	}{
+		{"/a", "b", "/a/b"},
+		{"/a", "b/c", "/a/b/c"},
+		{"/a", "/b/c", "/a/b/c"},
+		{"/a", ".", "/a"},
+		{"/a", "../b", "/a/b"},
+		{"/a", "b/../../c", "/a/c"},
+	}
+	for _, x := range pathList {
+		if s := getReplayPath(x.input, x.f); s != x.x {
+			t.Error(x, s)
+		}
+	}
+}
+
+func Test_runReplay(t *testing.T) {
+	keep := optKeepWritePaths
+	defer func() {
+		optKeepWritePaths = keep
+	}()
+
+	// gids are not contiguous, 1 and 4 are rebased on the second and the
+	// first inputs
+	lines := []string{
+		`{"gid":1,"op":"mkdir","path":"d"}`,
+		`{"gid":1,"op":"create","path":"d/x"}`,
+		`{"gid":1,"op":"write","path":"d/x","offset":0,"size":10}`,
+		`{"gid":4,"op":"create","path":"y"}`,
+		`{"gid":4,"op":"rename","path":"y","new_path":"z"}`,
+		`{"gid":4,"op":"stat","path":"f"}`,
+		`{"gid":4,"op":"create","path":"f"}`,
+		`{"gid":4,"op":"unlink","path":"f","result":"operation not permitted"}`,
+		`{"gid":4,"op":"mkdir","path":"e","result":"file exists"}`,
+		`{"gid":4,"op":"open","path":"f"}`,
+		`{"gid":4,"op":"close","path":"f"}`,
+	}
+	f := filepath.Join(t.TempDir(), "trace.json")
+	if err := os.WriteFile(f, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, keep := range []bool{true, false} {
+		optKeepWritePaths = keep
+		input := []string{t.TempDir(), t.TempDir()}
+		if err := os.WriteFile(filepath.Join(input[0], "f"), []byte("xxx"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := runReplay(f, input); err != nil {
+			t.Error(err)
+			continue
+		}
+		for _, x := range []struct {
+			f      string
+			exists bool
+		}{
+			{filepath.Join(input[1], "d/x"), keep},
+			{filepath.Join(input[1], "d"), keep},
+			{filepath.Join(input[0], "y"), false},
+			{filepath.Join(input[0], "z"), keep},
+			{filepath.Join(input[1], "z"), false},
+			{filepath.Join(input[0], "f"), true},
+			{filepath.Join(input[0], "e"), false},
+		} {
+			if exists, _ := pathExists(x.f); exists != x.exists {
+				t.Error(keep, x.f, exists)
+			}
+		}
+		// pre-existing file is never truncated nor unlinked
+		if b, err := os.ReadFile(filepath.Join(input[0], "f")); err != nil || string(b) != "xxx" {
+			t.Error(keep, string(b), err)
+		}
+	}
+}
+
+func Test_traceOpenFile(t *testing.T) {
+	traceFile := optTraceFile
+	readBufferSize := optReadBufferSize
+	defer func() {
+		optTraceFile = traceFile
+		optReadBufferSize = readBufferSize
+	}()
+	optTraceFile = filepath.Join(t.TempDir(), "trace.json")
+	optReadBufferSize = 1024
+
+	d := t.TempDir()
+	f := filepath.Join(d, "f")
+	if err := os.WriteFile(f, make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	thr := newRead(0, 1024)
+	thr.stat.setInputPath(d)
+	if err := openTrace(); err != nil {
+		t.Fatal(err)
+	}
+	err := readFileResid(f, -1, &thr)
+	if err := closeTrace(); err != nil {
+		t.Fatal(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := loadTraceFile(optTraceFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"open", "read", "read", "close"}
+	if len(l) != len(expected) {
+		t.Fatal(l)
+	}
+	for i, x := range l {
+		if x.Op != expected[i] || x.Path != "f" {
+			t.Error(i, x)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// scenarioPhase runs workers once with options applied on top of options
+// given on command line or config file.
+type scenarioPhase struct {
+	Name             string                 `json:"name"`
+	Options          map[string]interface{} `json:"options,omitempty"`
+	UnlinkWritePaths bool                   `json:"unlink_write_paths,omitempty"`
+}
+
+type scenarioFile struct {
+	Phases []scenarioPhase `json:"phases"`
+}
+
+func loadScenarioFile(f string) (*scenarioFile, error) {
+	b, err := os.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	var sf scenarioFile
+	if err := json.Unmarshal(b, &sf); err != nil {
+		return nil, fmt.Errorf("%s: %s", f, err)
+	}
+	if len(sf.Phases) == 0 {
+		return nil, fmt.Errorf("%s: no phases", f)
+	}
+	for i, ph := range sf.Phases {
+		if len(ph.Name) == 0 {
+			sf.Phases[i].Name = fmt.Sprintf("phase%d", i)
+		}
+		for k := range ph.Options {
+			if isProcessOption(k) {
+				return nil, fmt.Errorf("%s: option \"%s\" not allowed in phase", f, k)
+			}
+		}
+	}
+	return &sf, nil
+}
+
+func setPhaseOptions(ph scenarioPhase) error {
+	m := make(map[string]string)
+	for k, v := range ph.Options {
+		s, err := configValueString(v)
+		if err != nil {
+			return fmt.Errorf("option \"%s\": %s", k, err)
+		}
+		m[k] = s
+	}
+	if err := setOptions(m); err != nil {
+		return err
+	}
+	// write paths are unlinked after the last phase
+	optKeepWritePaths = true
+	return nil
+}
+
+func runScenario(f string, input []string) error {
+	sf, err := loadScenarioFile(f)
+	if err != nil {
+		return err
+	}
+	base := getOptions()
+	keepWritePaths := optKeepWritePaths
+
+	var writePaths []string
+	for i, ph := range sf.Phases {
+		fmt.Println(strings.Repeat("=", 80))
+		s := fmt.Sprintf("Phase %d/%d %s", i+1, len(sf.Phases), ph.Name)
+		fmt.Println(s)
+		dbg(s)
+
+		if err := setOptions(base); err != nil {
+			return err
+		}
+		if err := setPhaseOptions(ph); err != nil {
+			return fmt.Errorf("%s: %s", ph.Name, err)
+		}
+		fmt.Println("Seed", initSeed(uint(i)))
+		_, numInterrupted, numError, numRemain, tsv, err := dispatch(input)
+		if err != nil {
+			return fmt.Errorf("%s: %s", ph.Name, err)
+		}
+		writePaths = append(writePaths, keptWritePaths...)
+		if tsv != nil {
+			printSetResult(numInterrupted, numError, numRemain, tsv)
+		}
+
+		if ph.UnlinkWritePaths {
+			l, err := unlinkWritePaths(writePaths, -1)
+			if err != nil {
+				return fmt.Errorf("%s: %s", ph.Name, err)
+			}
+			fmt.Println("Unlinked", len(writePaths)-len(l), "/", len(writePaths), "write paths")
+			writePaths = l
+		}
+		if numInterrupted > 0 {
+			break
+		}
+	}
+
+	// restore options and cleanup write paths of all phases
+	if err := setOptions(base); err != nil {
+		return err
+	}
+	fmt.Println(strings.Repeat("=", 80))
+	if !keepWritePaths && len(writePaths) != 0 {
+		l, err := unlinkWritePaths(writePaths, -1)
+		if err != nil {
+			return err
+		}
+		writePaths = l
+	}
+	if n := len(writePaths); n > 0 {
+		var s string
+		if n > 1 {
+			s = "s"
+		}
+		fmt.Printf("%d write path%s remaining\n", n, s)
+	}
+	return nil
+}
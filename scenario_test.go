@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_loadScenarioFile(t *testing.T) {
+	d := t.TempDir()
+	validList := []struct {
+		s     string
+		names []string
+	}{
+		{`{"phases": [{}]}`, []string{"phase0"}},
+		{`{"phases": [{"name": "fill"}, {}, {"name": "age"}]}`, []string{"fill", "phase1", "age"}},
+	}
+	for i, x := range validList {
+		f := filepath.Join(d, fmt.Sprintf("valid%d", i))
+		if err := os.WriteFile(f, []byte(x.s), 0644); err != nil {
+			t.Fatal(err)
+		}
+		sf, err := loadScenarioFile(f)
+		if err != nil {
+			t.Error(x.s, err)
+			continue
+		}
+		if len(sf.Phases) != len(x.names) {
+			t.Error(x.s, sf.Phases)
+			continue
+		}
+		for j := range sf.Phases {
+			if sf.Phases[j].Name != x.names[j] {
+				t.Error(x.s, j, sf.Phases[j].Name)
+			}
+		}
+	}
+
+	invalidList := []string{
+		``,
+		`{}`,
+		`{"phases": []}`,
+		`{"phases": [{"options": {"sweep": "num_reader=1..2"}}]}`,
+		`{"phases": [{"options": {"scenario": "x"}}]}`,
+	}
+	for i, s := range invalidList {
+		f := filepath.Join(d, fmt.Sprintf("invalid%d", i))
+		if err := os.WriteFile(f, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if sf, err := loadScenarioFile(f); err == nil {
+			t.Error(s, sf)
+		}
+	}
+}
+
+func Test_setPhaseOptions(t *testing.T) {
+	s := `{
+		"phases": [
+			{"name": "fill", "options": {"num_writer": 2, "write_size": "4k", "num_write_paths": 10}},
+			{"name": "age", "options": {"num_reader": 3, "path_iter": "random"}, "unlink_write_paths": true},
+			{"name": "invalid", "options": {"num_reader": "x"}}
+		]
+	}`
+	f := filepath.Join(t.TempDir(), "scenario.json")
+	if err := os.WriteFile(f, []byte(s), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sf, err := loadScenarioFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sf.Phases) != 3 || !sf.Phases[1].UnlinkWritePaths {
+		t.Fatal(sf.Phases)
+	}
+
+	base := getOptions()
+	for k := range base {
+		if strings.HasPrefix(k, "test.") {
+			delete(base, k) // flags of go test
+		}
+	}
+	defer func() {
+		if err := setOptions(base); err != nil {
+			t.Error(err)
+		}
+	}()
+	if err := setOptions(base); err != nil {
+		t.Fatal(err)
+	}
+	numReader := optNumReader
+	numWriter := optNumWriter
+	pathIter := optPathIter
+	keepWritePaths := optKeepWritePaths
+
+	// each phase applies on top of base options, as by runScenario
+	if err := setPhaseOptions(sf.Phases[0]); err != nil {
+		t.Fatal(err)
+	}
+	if optNumWriter != 2 || optWriteSize == nil || optWriteSize.sample(nil) != 4096 ||
+		optNumWritePaths != 10 || optNumReader != numReader {
+		t.Error(optNumWriter, optWriteSize, optNumWritePaths, optNumReader)
+	}
+	if !optKeepWritePaths {
+		t.Error(optKeepWritePaths)
+	}
+
+	if err := setOptions(base); err != nil {
+		t.Fatal(err)
+	}
+	if err := setPhaseOptions(sf.Phases[1]); err != nil {
+		t.Fatal(err)
+	}
+	if optNumReader != 3 || optPathIter != pathIterRandom || optNumWriter != numWriter ||
+		optWriteSize != nil {
+		t.Error(optNumReader, optPathIter, optNumWriter, optWriteSize)
+	}
+	if !optKeepWritePaths {
+		t.Error(optKeepWritePaths)
+	}
+
+	if err := setOptions(base); err != nil {
+		t.Fatal(err)
+	}
+	if err := setPhaseOptions(sf.Phases[2]); err == nil {
+		t.Error(sf.Phases[2])
+	}
+
+	// options are restored after the last phase
+	if err := setOptions(base); err != nil {
+		t.Fatal(err)
+	}
+	if optNumReader != numReader || optNumWriter != numWriter || optPathIter != pathIter ||
+		optWriteSize != nil || optKeepWritePaths != keepWritePaths {
+		t.Error(optNumReader, optNumWriter, optPathIter, optWriteSize, optKeepWritePaths)
+	}
+}
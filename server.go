@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const (
+	serverStateIdle    = "idle"
+	serverStateRunning = "running"
+	serverStatePaused  = "paused"
+	serverStateDone    = "done"
+	serverStateFailed  = "failed"
+)
+
+type serverRunRequest struct {
+	Paths   []string          `json:"paths"`
+	Options map[string]string `json:"options"`
+}
+
+type serverRun struct {
+	Id      int               `json:"id"`
+	State   string            `json:"state"`
+	Paths   []string          `json:"paths"`
+	Options map[string]string `json:"options"`
+	Sets    []setResult       `json:"sets"`
+	Error   string            `json:"error,omitempty"`
+	stopped bool
+}
+
+type serverStat struct {
+	Id    int          `json:"id"`
+	State string       `json:"state"`
+	Set   int          `json:"set"`
+	Stats []threadStat `json:"stats"`
+}
+
+type server struct {
+	mtx    sync.Mutex
+	base   map[string]string
+	run    *serverRun
+	numRun int
+	wg     sync.WaitGroup
+}
+
+func newServer() *server {
+	return &server{
+		base: getOptions(),
+	}
+}
+
+func (this *server) getState() string {
+	if this.run == nil {
+		return serverStateIdle
+	}
+	if this.run.State == serverStateRunning && workerCtl.isPaused() {
+		return serverStatePaused
+	}
+	return this.run.State
+}
+
+func (this *server) isActive() bool {
+	return this.run != nil && this.run.State == serverStateRunning
+}
+
+func (this *server) handleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeServerError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s not allowed", r.Method))
+		return
+	}
+	var req serverRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeServerError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.Paths) == 0 {
+		writeServerError(w, http.StatusBadRequest, fmt.Errorf("empty paths"))
+		return
+	}
+	for k := range req.Options {
+		if isProcessOption(k) {
+			writeServerError(w, http.StatusBadRequest,
+				fmt.Errorf("option \"%s\" not allowed", k))
+			return
+		}
+	}
+
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+	if this.isActive() {
+		writeServerError(w, http.StatusConflict, fmt.Errorf("run %d active", this.run.Id))
+		return
+	}
+
+	// each run starts from options given on command line
+	if err := setOptions(this.base); err != nil {
+		writeServerError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := setOptions(req.Options); err != nil {
+		writeServerError(w, http.StatusBadRequest, err)
+		return
+	}
+	input, err := setupInput(req.Paths)
+	if err != nil {
+		writeServerError(w, http.StatusBadRequest, err)
+		return
+	}
+	dbg("input", input)
+
+	this.numRun++
+	this.run = &serverRun{
+		Id:      this.numRun,
+		State:   serverStateRunning,
+		Paths:   input,
+		Options: req.Options,
+	}
+	workerCtl.reset()
+	this.wg.Add(1)
+	go this.doRun(this.run, input)
+
+	writeServerJSON(w, http.StatusAccepted, this.run)
+}
+
+func (this *server) doRun(run *serverRun, input []string) {
+	defer this.wg.Done()
+	dbgf("run %d start", run.Id)
+	for i := uint(0); i < optNumSet; i++ {
+		this.mtx.Lock()
+		stopped := run.stopped
+		this.mtx.Unlock()
+		if stopped {
+			break
+		}
+
+		seed := initSeed(i)
+		numComplete, numInterrupted, numError, numRemain, tsv, err :=
+			dispatch(input)
+
+		this.mtx.Lock()
+		if err != nil {
+			run.State = serverStateFailed
+			run.Error = err.Error()
+			this.mtx.Unlock()
+			dbgf("run %d %s", run.Id, err)
+			return
+		}
+		run.Sets = append(run.Sets, setResult{
+			Seed:           seed,
+			NumComplete:    numComplete,
+			NumInterrupted: numInterrupted,
+			NumError:       numError,
+			NumRemain:      numRemain,
+			Stats:          tsv,
+		})
+		this.mtx.Unlock()
+		if numInterrupted > 0 {
+			break
+		}
+	}
+
+	this.mtx.Lock()
+	run.State = serverStateDone
+	this.mtx.Unlock()
+	dbgf("run %d done", run.Id)
+}
+
+func (this *server) handleStats(w http.ResponseWriter, r *http.Request) {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+	if this.run == nil {
+		writeServerError(w, http.StatusNotFound, fmt.Errorf("no run"))
+		return
+	}
+
+	x := serverStat{
+		Id:    this.run.Id,
+		State: this.getState(),
+		Set:   len(this.run.Sets),
+	}
+	if tsv := workerCtl.collectStat(); tsv != nil {
+		x.Set++ // in progress
+		x.Stats = tsv
+	} else if len(this.run.Sets) != 0 {
+		x.Stats = this.run.Sets[len(this.run.Sets)-1].Stats
+	}
+	writeServerJSON(w, http.StatusOK, x)
+}
+
+func (this *server) handleResult(w http.ResponseWriter, r *http.Request) {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+	if this.run == nil {
+		writeServerError(w, http.StatusNotFound, fmt.Errorf("no run"))
+		return
+	}
+	x := *this.run
+	x.State = this.getState()
+	writeServerJSON(w, http.StatusOK, x)
+}
+
+func (this *server) handleControl(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeServerError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s not allowed", r.Method))
+		return
+	}
+
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+	if !this.isActive() {
+		writeServerError(w, http.StatusConflict, fmt.Errorf("no active run"))
+		return
+	}
+
+	op := strings.TrimPrefix(r.URL.Path, "/")
+	dbgf("run %d %s", this.run.Id, op)
+	switch op {
+	case "pause":
+		workerCtl.pause()
+	case "resume":
+		workerCtl.resume()
+	case "stop":
+		this.run.stopped = true
+		workerCtl.stop()
+	default:
+		assert(false)
+	}
+
+	x := *this.run
+	x.State = this.getState()
+	writeServerJSON(w, http.StatusOK, x)
+}
+
+func (this *server) newMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/run", this.handleRun)
+	mux.HandleFunc("/stats", this.handleStats)
+	mux.HandleFunc("/result", this.handleResult)
+	mux.HandleFunc("/pause", this.handleControl)
+	mux.HandleFunc("/resume", this.handleControl)
+	mux.HandleFunc("/stop", this.handleControl)
+	return mux
+}
+
+func writeServerJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		dbg(err)
+	}
+}
+
+func writeServerError(w http.ResponseWriter, code int, err error) {
+	writeServerJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+func listenServer(addr string) (net.Listener, error) {
+	if strings.HasPrefix(addr, "unix:") {
+		f := strings.TrimPrefix(addr, "unix:")
+		if len(f) == 0 {
+			return nil, fmt.Errorf("empty unix domain socket path")
+		}
+		// remove stale socket
+		if info, err := os.Lstat(f); err == nil && info.Mode()&os.ModeSocket != 0 {
+			if err := os.Remove(f); err != nil {
+				return nil, err
+			}
+		}
+		return net.Listen("unix", f)
+	}
+	return net.Listen("tcp", addr)
+}
+
+func runServer(addr string) error {
+	l, err := listenServer(addr)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Listening on", l.Addr())
+	dbg("listen", l.Addr())
+
+	this := newServer()
+	srv := &http.Server{Handler: this.newMux()}
+
+	// SIGINT is left for workers, use SIGTERM to shutdown
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	doneCh := make(chan int)
+	go func() {
+		defer wg.Done()
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGTERM)
+		defer signal.Stop(ch)
+		select {
+		case <-doneCh:
+		case s := <-ch:
+			dbg("signal", s)
+			workerCtl.stop()
+			if err := srv.Close(); err != nil {
+				dbg(err)
+			}
+		}
+	}()
+
+	err = srv.Serve(l)
+	close(doneCh)
+	wg.Wait()
+	this.wg.Wait() // let active run cleanup write paths
+	if err == http.ErrServerClosed {
+		err = nil
+	}
+	return err
+}
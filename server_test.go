@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func serverRequest(t *testing.T, method string, url string, v interface{}, x interface{}) int {
+	var b []byte
+	if v != nil {
+		var err error
+		if b, err = json.Marshal(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if x != nil {
+		if err := json.NewDecoder(resp.Body).Decode(x); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func Test_server(t *testing.T) {
+	d := t.TempDir()
+	for _, s := range []string{"a", "b", "c"} {
+		if err := os.WriteFile(filepath.Join(d, s), []byte("xxx"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	this := newServer()
+	for k := range this.base {
+		if strings.HasPrefix(k, "test.") {
+			delete(this.base, k) // flags of go test
+		}
+	}
+	defer func() {
+		if err := setOptions(this.base); err != nil {
+			t.Error(err)
+		}
+	}()
+	ts := httptest.NewServer(this.newMux())
+	defer ts.Close()
+
+	// no run yet
+	if code := serverRequest(t, "GET", ts.URL+"/stats", nil, nil); code != http.StatusNotFound {
+		t.Error(code)
+	}
+	if code := serverRequest(t, "POST", ts.URL+"/pause", nil, nil); code != http.StatusConflict {
+		t.Error(code)
+	}
+	if code := serverRequest(t, "GET", ts.URL+"/run", nil, nil); code != http.StatusMethodNotAllowed {
+		t.Error(code)
+	}
+	req := serverRunRequest{
+		Paths:   []string{d},
+		Options: map[string]string{"num_reader": "1", "time_second": "60"},
+	}
+	if code := serverRequest(t, "POST", ts.URL+"/run",
+		serverRunRequest{Options: req.Options}, nil); code != http.StatusBadRequest {
+		t.Error(code)
+	}
+	if code := serverRequest(t, "POST", ts.URL+"/run",
+		serverRunRequest{Paths: []string{d}, Options: map[string]string{"scenario": "x"}},
+		nil); code != http.StatusBadRequest {
+		t.Error(code)
+	}
+
+	// run until stopped
+	var run serverRun
+	if code := serverRequest(t, "POST", ts.URL+"/run", req, &run); code != http.StatusAccepted ||
+		run.Id != 1 || run.State != serverStateRunning {
+		t.Error(code, run)
+	}
+	if code := serverRequest(t, "POST", ts.URL+"/run", req, nil); code != http.StatusConflict {
+		t.Error(code)
+	}
+	var st serverStat
+	if code := serverRequest(t, "GET", ts.URL+"/stats", nil, &st); code != http.StatusOK ||
+		st.Id != 1 || st.State != serverStateRunning {
+		t.Error(code, st)
+	}
+	for _, x := range []struct {
+		op    string
+		state string
+	}{
+		{"pause", serverStatePaused},
+		{"resume", serverStateRunning},
+		{"stop", serverStateRunning}, // until workers exit
+	} {
+		run = serverRun{}
+		if code := serverRequest(t, "POST", ts.URL+"/"+x.op, nil, &run); code != http.StatusOK ||
+			run.State != x.state {
+			t.Error(x.op, code, run)
+		}
+	}
+	this.wg.Wait()
+
+	run = serverRun{}
+	if code := serverRequest(t, "GET", ts.URL+"/result", nil, &run); code != http.StatusOK ||
+		run.State != serverStateDone || len(run.Sets) != 1 || run.Sets[0].NumInterrupted != 1 {
+		t.Error(code, run)
+	}
+	st = serverStat{}
+	if code := serverRequest(t, "GET", ts.URL+"/stats", nil, &st); code != http.StatusOK ||
+		st.State != serverStateDone || st.Set != 1 || len(st.Stats) != 1 ||
+		st.Stats[0].numRead == 0 {
+		t.Error(code, st)
+	}
+	if code := serverRequest(t, "POST", ts.URL+"/stop", nil, nil); code != http.StatusConflict {
+		t.Error(code)
+	}
+
+	// next run completes by itself
+	req.Options = map[string]string{"num_reader": "1", "num_repeat": "2"}
+	run = serverRun{}
+	if code := serverRequest(t, "POST", ts.URL+"/run", req, &run); code != http.StatusAccepted ||
+		run.Id != 2 {
+		t.Error(code, run)
+	}
+	this.wg.Wait()
+	run = serverRun{}
+	if code := serverRequest(t, "GET", ts.URL+"/result", nil, &run); code != http.StatusOK ||
+		run.State != serverStateDone || len(run.Sets) != 1 ||
+		run.Sets[0].NumComplete != 1 || run.Sets[0].Stats[0].numRepeat != 2 {
+		t.Error(code, run)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+const (
+	sizeDistFixed = iota
+	sizeDistUniform
+	sizeDistLognormal
+	sizeDistHistogram
+	sizeDistBimodal
+)
+
+// sizeDist is a distribution of sizes in bytes.
+type sizeDist struct {
+	typ   int
+	min   int64 // median for lognormal
+	max   int64
+	sigma float64 // lognormal only
+	ratio float64 // bimodal only, probability of the first bin
+	bins  []sizeDistBin
+}
+
+// sizeDistBin is a fixed or uniform distribution weighted in a histogram.
+type sizeDistBin struct {
+	dist   *sizeDist
+	weight int64
+}
+
+// parseSizeDist parses <size> as fixed size, <min>..<max> as uniform
+// distribution, lognormal:<median>:<sigma> as log-normal distribution, or
+// bimodal:<small>:<large>:<ratio> as small or large size with ratio of
+// small, or comma separated <size>=<weight> or <min>..<max>=<weight> as
+// histogram, where each size can have k|m|g|t suffix.
+func parseSizeDist(s string) (*sizeDist, error) {
+	if strings.HasPrefix(s, "bimodal:") {
+		v := strings.Split(strings.TrimPrefix(s, "bimodal:"), ":")
+		if len(v) != 3 {
+			return nil, fmt.Errorf("invalid bimodal distribution %s", s)
+		}
+		this := &sizeDist{typ: sizeDistBimodal}
+		for _, x := range v[:2] {
+			d, err := parseSizeDist(x)
+			if err != nil {
+				return nil, err
+			} else if d.typ != sizeDistFixed && d.typ != sizeDistUniform {
+				return nil, fmt.Errorf("invalid bimodal distribution %s", s)
+			}
+			this.bins = append(this.bins, sizeDistBin{d, 0})
+		}
+		ratio, err := strconv.ParseFloat(v[2], 64)
+		if err != nil {
+			return nil, err
+		}
+		if ratio < 0 || ratio > 1 {
+			return nil, fmt.Errorf("invalid bimodal ratio %s", s)
+		}
+		this.ratio = ratio
+		this.min = this.bins[0].dist.min
+		if this.bins[1].dist.min < this.min {
+			this.min = this.bins[1].dist.min
+		}
+		this.max = this.bins[0].dist.max
+		if this.bins[1].dist.max > this.max {
+			this.max = this.bins[1].dist.max
+		}
+		return this, nil
+	}
+
+	if strings.HasPrefix(s, "lognormal:") {
+		v := strings.Split(strings.TrimPrefix(s, "lognormal:"), ":")
+		if len(v) != 2 {
+			return nil, fmt.Errorf("invalid log-normal distribution %s", s)
+		}
+		median, err := parseSize(v[0])
+		if err != nil {
+			return nil, err
+		}
+		sigma, err := strconv.ParseFloat(v[1], 64)
+		if err != nil {
+			return nil, err
+		}
+		if median <= 0 || sigma < 0 {
+			return nil, fmt.Errorf("invalid log-normal distribution %s", s)
+		}
+		return &sizeDist{typ: sizeDistLognormal, min: median, sigma: sigma}, nil
+	}
+
+	if strings.Contains(s, "=") {
+		this := &sizeDist{typ: sizeDistHistogram}
+		for i, x := range strings.Split(s, ",") {
+			v := strings.SplitN(x, "=", 2)
+			if len(v) != 2 {
+				return nil, fmt.Errorf("invalid histogram bin %s", x)
+			}
+			d, err := parseSizeDist(v[0])
+			if err != nil {
+				return nil, err
+			} else if d.typ != sizeDistFixed && d.typ != sizeDistUniform {
+				return nil, fmt.Errorf("invalid histogram bin %s", x)
+			}
+			w, err := strconv.ParseInt(v[1], 10, 64)
+			if err != nil {
+				return nil, err
+			} else if w <= 0 {
+				return nil, fmt.Errorf("invalid histogram weight %s", x)
+			}
+			this.bins = append(this.bins, sizeDistBin{d, w})
+			if i == 0 || d.min < this.min {
+				this.min = d.min
+			}
+			if d.max > this.max {
+				this.max = d.max
+			}
+		}
+		return this, nil
+	}
+
+	if strings.Contains(s, "..") {
+		v := strings.SplitN(s, "..", 2)
+		min, err := parseSize(v[0])
+		if err != nil {
+			return nil, err
+		}
+		max, err := parseSize(v[1])
+		if err != nil {
+			return nil, err
+		}
+		if min < 0 || max < min {
+			return nil, fmt.Errorf("invalid size range %s", s)
+		}
+		return &sizeDist{typ: sizeDistUniform, min: min, max: max}, nil
+	}
+
+	n, err := parseSize(s)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("invalid size %s", s)
+	}
+	return &sizeDist{typ: sizeDistFixed, min: n, max: n}, nil
+}
+
+func (this *sizeDist) sample(r *rand.Rand) int64 {
+	switch this.typ {
+	case sizeDistFixed:
+		return this.min
+	case sizeDistUniform:
+		return this.min + r.Int63n(this.max-this.min+1)
+	case sizeDistLognormal:
+		x := float64(this.min) * math.Exp(this.sigma*r.NormFloat64())
+		if x >= math.MaxInt64 {
+			return math.MaxInt64
+		}
+		return int64(x)
+	case sizeDistHistogram:
+		total := int64(0)
+		for _, b := range this.bins {
+			total += b.weight
+		}
+		n := r.Int63n(total)
+		for _, b := range this.bins {
+			if n < b.weight {
+				return b.dist.sample(r)
+			}
+			n -= b.weight
+		}
+		assert(false)
+		return -1
+	case sizeDistBimodal:
+		if r.Float64() < this.ratio {
+			return this.bins[0].dist.sample(r)
+		}
+		return this.bins[1].dist.sample(r)
+	default:
+		assert(false)
+		return -1
+	}
+}
+
+func (this *sizeDist) String() string {
+	switch this.typ {
+	case sizeDistFixed:
+		return fmt.Sprintf("%d", this.min)
+	case sizeDistUniform:
+		return fmt.Sprintf("%d..%d", this.min, this.max)
+	case sizeDistLognormal:
+		return fmt.Sprintf("lognormal:%d:%g", this.min, this.sigma)
+	case sizeDistHistogram:
+		var l []string
+		for _, b := range this.bins {
+			l = append(l, fmt.Sprintf("%s=%d", b.dist, b.weight))
+		}
+		return strings.Join(l, ",")
+	case sizeDistBimodal:
+		return fmt.Sprintf("bimodal:%s:%s:%g", this.bins[0].dist,
+			this.bins[1].dist, this.ratio)
+	default:
+		assert(false)
+		return ""
+	}
+}
+
+// parseResidSize parses residual size per file read or write, which is nil
+// if negative, random size up to bufsiz if 0, or size distribution.
+func parseResidSize(s string, bufsiz uint) (*sizeDist, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 {
+			return nil, nil
+		} else if n == 0 {
+			if bufsiz == 0 {
+				return nil, fmt.Errorf("invalid buffer size %d", bufsiz)
+			}
+			return &sizeDist{typ: sizeDistUniform, min: 1, max: int64(bufsiz)}, nil
+		}
+	}
+	return parseSizeDist(s)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func Test_parseSizeDist(t *testing.T) {
+	validList := []struct {
+		s   string
+		typ int
+		min int64
+		max int64
+	}{
+		{"0", sizeDistFixed, 0, 0},
+		{"4k", sizeDistFixed, 4096, 4096},
+		{"1k..64k", sizeDistUniform, 1024, 65536},
+		{"0..0", sizeDistUniform, 0, 0},
+	}
+	for _, x := range validList {
+		d, err := parseSizeDist(x.s)
+		if err != nil {
+			t.Error(x.s, err)
+			continue
+		}
+		if d.typ != x.typ || d.min != x.min || d.max != x.max {
+			t.Error(x.s, d)
+		}
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < 1000; i++ {
+			if n := d.sample(r); n < x.min || n > x.max {
+				t.Error(x.s, n)
+			}
+		}
+	}
+
+	invalidList := []string{
+		"",
+		"-1",
+		"x",
+		"..",
+		"1k..",
+		"..1k",
+		"64k..1k",
+		"-1..1k",
+		"lognormal:",
+		"lognormal:64k",
+		"lognormal:0:1",
+		"lognormal:64k:-1",
+		"lognormal:64k:x",
+		"=1",
+		"4k=",
+		"4k=0",
+		"4k=x",
+		"4k=1,",
+		"lognormal:64k:1=1"}
+	for _, s := range invalidList {
+		if d, err := parseSizeDist(s); err == nil {
+			t.Error(s, d)
+		}
+	}
+}
+
+func Test_parseSizeDistLognormal(t *testing.T) {
+	d, err := parseSizeDist("lognormal:64k:1.5")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if d.typ != sizeDistLognormal || d.min != 65536 || d.sigma != 1.5 {
+		t.Error(d)
+	}
+	if s := d.String(); s != "lognormal:65536:1.5" {
+		t.Error(s)
+	}
+
+	// about half of samples are below median
+	r := rand.New(rand.NewSource(1))
+	n := 0
+	for i := 0; i < 10000; i++ {
+		if x := d.sample(r); x < 0 {
+			t.Error(x)
+		} else if x < d.min {
+			n++
+		}
+	}
+	if n < 4500 || n > 5500 {
+		t.Error(n)
+	}
+}
+
+func Test_parseSizeDistHistogram(t *testing.T) {
+	d, err := parseSizeDist("4k=3,1k..2k=1")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if d.typ != sizeDistHistogram || len(d.bins) != 2 || d.min != 1024 || d.max != 4096 {
+		t.Error(d)
+	}
+	if s := d.String(); s != "4096=3,1024..2048=1" {
+		t.Error(s)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	n := 0
+	for i := 0; i < 10000; i++ {
+		if x := d.sample(r); x == 4096 {
+			n++
+		} else if x < 1024 || x > 2048 {
+			t.Error(x)
+		}
+	}
+	if n < 7000 || n > 8000 {
+		t.Error(n)
+	}
+}
+
+func Test_parseSizeDistBimodal(t *testing.T) {
+	d, err := parseSizeDist("bimodal:4k:1m..2m:0.9")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if d.typ != sizeDistBimodal || d.min != 4096 || d.max != 2<<20 || d.ratio != 0.9 {
+		t.Error(d)
+	}
+	if s := d.String(); s != "bimodal:4096:1048576..2097152:0.9" {
+		t.Error(s)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	n := 0
+	for i := 0; i < 10000; i++ {
+		if x := d.sample(r); x == 4096 {
+			n++
+		} else if x < 1<<20 || x > 2<<20 {
+			t.Error(x)
+		}
+	}
+	if n < 8500 || n > 9500 {
+		t.Error(n)
+	}
+
+	invalidList := []string{
+		"bimodal:",
+		"bimodal:4k:1m",
+		"bimodal:4k:1m:x",
+		"bimodal:4k:1m:1.1",
+		"bimodal:4k:1m:-0.1",
+		"bimodal:4k:lognormal:1m:1:0.5",
+		"bimodal:4k=1:1m:0.5",
+	}
+	for _, s := range invalidList {
+		if d, err := parseSizeDist(s); err == nil {
+			t.Error(s, d)
+		}
+	}
+}
+
+func Test_parseResidSize(t *testing.T) {
+	residList := []struct {
+		s   string
+		nil bool
+		min int64
+		max int64
+	}{
+		{"-1", true, 0, 0},
+		{"-2", true, 0, 0},
+		{"0", false, 1, 4096},
+		{"1", false, 1, 1},
+		{"1g", false, 1 << 30, 1 << 30},
+		{"1m..100g", false, 1 << 20, 100 << 30},
+	}
+	for _, x := range residList {
+		d, err := parseResidSize(x.s, 4096)
+		if err != nil {
+			t.Error(x.s, err)
+		} else if x.nil {
+			if d != nil {
+				t.Error(x.s, d)
+			}
+		} else if d == nil || d.min != x.min || d.max != x.max {
+			t.Error(x.s, d)
+		}
+	}
+
+	if d, err := parseResidSize("0", 0); err == nil {
+		t.Error(d)
+	}
+}
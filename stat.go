@@ -1,23 +1,235 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"math/bits"
 	"strconv"
 	"strings"
 	"time"
 )
 
+const (
+	latencySubBucketBits = 2
+	numLatencySubBucket  = 1 << latencySubBucketBits
+	numLatencyBucket     = (64 - latencySubBucketBits + 1) * numLatencySubBucket
+)
+
+// latencyStat is a histogram of latency in nanoseconds, each power of 2
+// range is split into numLatencySubBucket buckets.
+type latencyStat struct {
+	Count   uint64   `json:"count"`
+	Sum     uint64   `json:"sum"`
+	Min     uint64   `json:"min"`
+	Max     uint64   `json:"max"`
+	Buckets []uint64 `json:"buckets,omitempty"`
+}
+
+func getLatencyBucket(ns uint64) int {
+	if ns < numLatencySubBucket {
+		return int(ns)
+	}
+	e := bits.Len64(ns) - 1
+	sub := (ns >> (e - latencySubBucketBits)) & (numLatencySubBucket - 1)
+	return (e-latencySubBucketBits+1)*numLatencySubBucket + int(sub)
+}
+
+func getLatencyBucketMax(i int) uint64 {
+	if i < numLatencySubBucket {
+		return uint64(i)
+	}
+	e := i/numLatencySubBucket + latencySubBucketBits - 1
+	sub := uint64(i % numLatencySubBucket)
+	lower := (numLatencySubBucket + sub) << (e - latencySubBucketBits)
+	return lower + (1 << (e - latencySubBucketBits)) - 1
+}
+
+func (this *latencyStat) add(d time.Duration) {
+	ns := uint64(0)
+	if d > 0 {
+		ns = uint64(d)
+	}
+	if this.Buckets == nil {
+		this.Buckets = make([]uint64, numLatencyBucket)
+	}
+	if this.Count == 0 || ns < this.Min {
+		this.Min = ns
+	}
+	if ns > this.Max {
+		this.Max = ns
+	}
+	this.Count++
+	this.Sum += ns
+	this.Buckets[getLatencyBucket(ns)]++
+}
+
+func (this *latencyStat) merge(x *latencyStat) {
+	if x.Count == 0 {
+		return
+	}
+	if this.Buckets == nil {
+		this.Buckets = make([]uint64, numLatencyBucket)
+	}
+	if this.Count == 0 || x.Min < this.Min {
+		this.Min = x.Min
+	}
+	if x.Max > this.Max {
+		this.Max = x.Max
+	}
+	this.Count += x.Count
+	this.Sum += x.Sum
+	for i := 0; i < len(x.Buckets) && i < len(this.Buckets); i++ {
+		this.Buckets[i] += x.Buckets[i]
+	}
+}
+
+func (this *latencyStat) mean() time.Duration {
+	if this.Count == 0 {
+		return 0
+	}
+	return time.Duration(this.Sum / this.Count)
+}
+
+// percentile returns upper bound of the bucket which has p percentile.
+func (this *latencyStat) percentile(p float64) time.Duration {
+	if this.Count == 0 {
+		return 0
+	}
+	n := uint64(p / 100 * float64(this.Count))
+	if n == 0 {
+		n = 1
+	} else if n > this.Count {
+		n = this.Count
+	}
+	total := uint64(0)
+	for i, x := range this.Buckets {
+		total += x
+		if total >= n {
+			if ns := getLatencyBucketMax(i); ns < this.Max {
+				return time.Duration(ns)
+			}
+			break
+		}
+	}
+	return time.Duration(this.Max)
+}
+
 type threadStat struct {
-	isReader      bool
-	inputPath     string
-	timeBegin     time.Time
-	timeEnd       time.Time
-	numRepeat     uint64
-	numStat       uint64
-	numRead       uint64
-	numReadBytes  uint64
-	numWrite      uint64
-	numWriteBytes uint64
+	isReader           bool
+	inputPath          string
+	timeBegin          time.Time
+	timeEnd            time.Time
+	numRepeat          uint64
+	numStat            uint64
+	numRead            uint64
+	numReadBytes       uint64
+	numWrite           uint64
+	numWriteBytes      uint64
+	readLatency        latencyStat
+	writeLatency       latencyStat
+	numOp              uint64 // personality specific operations
+	opLatency          latencyStat
+	opSizeLatency      []latencyStat // opLatency per size bucket if used
+	numDataBytes       uint64        // write data generated per block
+	numDataIncompBytes uint64
+	numDataBlock       uint64
+	numDataUniqueBlock uint64
+	flushLatency       []latencyStat // per flush type if used
+	copyLatency        []latencyStat // per copy method if used
+	numCopyFallback    uint64
+	extentLatency      []latencyStat // per extent op if used
+	numExtentFallback  []uint64
+}
+
+// threadStatJSON is an exported form of threadStat for encoding/json.
+type threadStatJSON struct {
+	IsReader           bool          `json:"is_reader"`
+	InputPath          string        `json:"input_path"`
+	TimeBegin          time.Time     `json:"time_begin"`
+	TimeEnd            time.Time     `json:"time_end"`
+	NumRepeat          uint64        `json:"num_repeat"`
+	NumStat            uint64        `json:"num_stat"`
+	NumRead            uint64        `json:"num_read"`
+	NumReadBytes       uint64        `json:"num_read_bytes"`
+	NumWrite           uint64        `json:"num_write"`
+	NumWriteBytes      uint64        `json:"num_write_bytes"`
+	ReadLatency        latencyStat   `json:"read_latency"`
+	WriteLatency       latencyStat   `json:"write_latency"`
+	NumOp              uint64        `json:"num_op"`
+	OpLatency          latencyStat   `json:"op_latency"`
+	OpSizeLatency      []latencyStat `json:"op_size_latency,omitempty"`
+	NumDataBytes       uint64        `json:"num_data_bytes,omitempty"`
+	NumDataIncompBytes uint64        `json:"num_data_incomp_bytes,omitempty"`
+	NumDataBlock       uint64        `json:"num_data_block,omitempty"`
+	NumDataUniqueBlock uint64        `json:"num_data_unique_block,omitempty"`
+	FlushLatency       []latencyStat `json:"flush_latency,omitempty"`
+	CopyLatency        []latencyStat `json:"copy_latency,omitempty"`
+	NumCopyFallback    uint64        `json:"num_copy_fallback,omitempty"`
+	ExtentLatency      []latencyStat `json:"extent_latency,omitempty"`
+	NumExtentFallback  []uint64      `json:"num_extent_fallback,omitempty"`
+}
+
+func (this threadStat) MarshalJSON() ([]byte, error) {
+	return json.Marshal(threadStatJSON{
+		IsReader:           this.isReader,
+		InputPath:          this.inputPath,
+		TimeBegin:          this.timeBegin,
+		TimeEnd:            this.timeEnd,
+		NumRepeat:          this.numRepeat,
+		NumStat:            this.numStat,
+		NumRead:            this.numRead,
+		NumReadBytes:       this.numReadBytes,
+		NumWrite:           this.numWrite,
+		NumWriteBytes:      this.numWriteBytes,
+		ReadLatency:        this.readLatency,
+		WriteLatency:       this.writeLatency,
+		NumOp:              this.numOp,
+		OpLatency:          this.opLatency,
+		OpSizeLatency:      this.opSizeLatency,
+		NumDataBytes:       this.numDataBytes,
+		NumDataIncompBytes: this.numDataIncompBytes,
+		NumDataBlock:       this.numDataBlock,
+		NumDataUniqueBlock: this.numDataUniqueBlock,
+		FlushLatency:       this.flushLatency,
+		CopyLatency:        this.copyLatency,
+		NumCopyFallback:    this.numCopyFallback,
+		ExtentLatency:      this.extentLatency,
+		NumExtentFallback:  this.numExtentFallback,
+	})
+}
+
+func (this *threadStat) UnmarshalJSON(b []byte) error {
+	var x threadStatJSON
+	if err := json.Unmarshal(b, &x); err != nil {
+		return err
+	}
+	*this = threadStat{
+		isReader:           x.IsReader,
+		inputPath:          x.InputPath,
+		timeBegin:          x.TimeBegin,
+		timeEnd:            x.TimeEnd,
+		numRepeat:          x.NumRepeat,
+		numStat:            x.NumStat,
+		numRead:            x.NumRead,
+		numReadBytes:       x.NumReadBytes,
+		numWrite:           x.NumWrite,
+		numWriteBytes:      x.NumWriteBytes,
+		readLatency:        x.ReadLatency,
+		writeLatency:       x.WriteLatency,
+		numOp:              x.NumOp,
+		opLatency:          x.OpLatency,
+		opSizeLatency:      x.OpSizeLatency,
+		numDataBytes:       x.NumDataBytes,
+		numDataIncompBytes: x.NumDataIncompBytes,
+		numDataBlock:       x.NumDataBlock,
+		numDataUniqueBlock: x.NumDataUniqueBlock,
+		flushLatency:       x.FlushLatency,
+		copyLatency:        x.CopyLatency,
+		numCopyFallback:    x.NumCopyFallback,
+		extentLatency:      x.ExtentLatency,
+		numExtentFallback:  x.NumExtentFallback,
+	}
+	return nil
 }
 
 func newReadStat() threadStat {
@@ -70,6 +282,97 @@ func (this *threadStat) addNumWriteBytes(siz int) {
 	this.numWriteBytes += uint64(siz)
 }
 
+func (this *threadStat) addReadLatency(d time.Duration) {
+	this.readLatency.add(d)
+}
+
+func (this *threadStat) addWriteLatency(d time.Duration) {
+	this.writeLatency.add(d)
+}
+
+func (this *threadStat) incNumOp() {
+	this.numOp++
+}
+
+func (this *threadStat) addOpLatency(d time.Duration) {
+	this.opLatency.add(d)
+}
+
+// opSizeBucketList is upper bounds of size buckets for opSizeLatency,
+// the last bucket has no upper bound.
+var opSizeBucketList = []int64{1 << 12, 1 << 16, 1 << 20, 1 << 24}
+
+func getOpSizeBucket(siz int64) int {
+	for i, x := range opSizeBucketList {
+		if siz < x {
+			return i
+		}
+	}
+	return len(opSizeBucketList)
+}
+
+func (this *threadStat) addOpSizeLatency(siz int64, d time.Duration) {
+	if this.opSizeLatency == nil {
+		this.opSizeLatency = make([]latencyStat, len(opSizeBucketList)+1)
+	}
+	this.opSizeLatency[getOpSizeBucket(siz)].add(d)
+}
+
+func (this *threadStat) addFlushLatency(typ int, d time.Duration) {
+	if this.flushLatency == nil {
+		this.flushLatency = make([]latencyStat, numFlushType)
+	}
+	this.flushLatency[typ].add(d)
+}
+
+// mergeFlushLatency merges latencies of flushes not issued by the thread
+// itself, such as syncfs(2) by a separate Goroutine.
+func (this *threadStat) mergeFlushLatency(typ int, x *latencyStat) {
+	if x.Count == 0 {
+		return
+	}
+	if this.flushLatency == nil {
+		this.flushLatency = make([]latencyStat, numFlushType)
+	}
+	this.flushLatency[typ].merge(x)
+}
+
+func (this *threadStat) addCopyLatency(method int, d time.Duration) {
+	if this.copyLatency == nil {
+		this.copyLatency = make([]latencyStat, numCopyMethod)
+	}
+	this.copyLatency[method].add(d)
+}
+
+func (this *threadStat) incNumCopyFallback() {
+	this.numCopyFallback++
+}
+
+func (this *threadStat) addExtentLatency(op int, d time.Duration) {
+	if this.extentLatency == nil {
+		this.extentLatency = make([]latencyStat, numExtentOp)
+	}
+	this.extentLatency[op].add(d)
+}
+
+func (this *threadStat) incNumExtentFallback(op int) {
+	if this.numExtentFallback == nil {
+		this.numExtentFallback = make([]uint64, numExtentOp)
+	}
+	this.numExtentFallback[op]++
+}
+
+// addDataBlock counts a block of write data with incomp incompressible bytes.
+func (this *threadStat) addDataBlock(siz int, incomp int, unique bool) {
+	assert(incomp <= siz)
+	this.numDataBytes += uint64(siz)
+	this.numDataIncompBytes += uint64(incomp)
+	this.numDataBlock++
+	if unique {
+		this.numDataUniqueBlock++
+	}
+}
+
 func printStat(tsv []threadStat) {
 	// repeat
 	widthRepeat := len("repeat")
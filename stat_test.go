@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 )
@@ -183,3 +184,118 @@ func Test_addNumWriteBytes(t *testing.T) {
 		t.Error(ts.numWriteBytes)
 	}
 }
+
+func Test_threadStatJSON(t *testing.T) {
+	ts := newWriteStat()
+	ts.setInputPath("/path/to/xxx")
+	ts.setTimeBegin()
+	ts.incNumRepeat()
+	ts.incNumStat()
+	ts.incNumRead()
+	ts.addNumReadBytes(1234)
+	ts.incNumWrite()
+	ts.addNumWriteBytes(5678)
+	ts.setTimeEnd()
+
+	b, err := json.Marshal(ts)
+	if err != nil {
+		t.Error(err)
+	}
+	var x threadStat
+	if err := json.Unmarshal(b, &x); err != nil {
+		t.Error(err)
+	}
+	if x.isReader != ts.isReader {
+		t.Error(x.isReader)
+	}
+	if x.inputPath != ts.inputPath {
+		t.Error(x.inputPath)
+	}
+	if !x.timeBegin.Equal(ts.timeBegin) || !x.timeEnd.Equal(ts.timeEnd) {
+		t.Error(x.timeBegin, x.timeEnd)
+	}
+	if x.numRepeat != 1 || x.numStat != 1 || x.numRead != 1 || x.numWrite != 1 {
+		t.Error(x.numRepeat, x.numStat, x.numRead, x.numWrite)
+	}
+	if x.numReadBytes != 1234 || x.numWriteBytes != 5678 {
+		t.Error(x.numReadBytes, x.numWriteBytes)
+	}
+}
+
+func Test_getLatencyBucket(t *testing.T) {
+	prev := -1
+	for ns := uint64(0); ns < 1<<16; ns++ {
+		i := getLatencyBucket(ns)
+		if i < prev || i > prev+1 {
+			t.Error(ns, i, prev)
+		}
+		if x := getLatencyBucketMax(i); ns > x {
+			t.Error(ns, i, x)
+		}
+		prev = i
+	}
+	if i := getLatencyBucket(^uint64(0)); i != numLatencyBucket-1 {
+		t.Error(i)
+	}
+	if x := getLatencyBucketMax(numLatencyBucket - 1); x != ^uint64(0) {
+		t.Error(x)
+	}
+}
+
+func Test_latencyStat(t *testing.T) {
+	var ls latencyStat
+	if ls.mean() != 0 || ls.percentile(50) != 0 {
+		t.Error(ls)
+	}
+	for i := 1; i <= 100; i++ {
+		ls.add(time.Duration(i) * time.Microsecond)
+	}
+	if ls.Count != 100 {
+		t.Error(ls.Count)
+	}
+	if ls.Min != uint64(time.Microsecond) || ls.Max != uint64(100*time.Microsecond) {
+		t.Error(ls.Min, ls.Max)
+	}
+	if d := ls.mean(); d != 50500*time.Nanosecond {
+		t.Error(d)
+	}
+	// buckets have 25% resolution
+	if d := ls.percentile(50); d < 50*time.Microsecond || d > 63*time.Microsecond {
+		t.Error(d)
+	}
+	if d := ls.percentile(100); d != 100*time.Microsecond {
+		t.Error(d)
+	}
+
+	var x latencyStat
+	x.merge(&ls)
+	x.merge(&ls)
+	if x.Count != 200 || x.Sum != ls.Sum*2 || x.Min != ls.Min || x.Max != ls.Max {
+		t.Error(x.Count, x.Sum, x.Min, x.Max)
+	}
+	if x.percentile(50) != ls.percentile(50) {
+		t.Error(x.percentile(50), ls.percentile(50))
+	}
+}
+
+func Test_mergeFlushLatency(t *testing.T) {
+	ts := newWriteStat()
+	var ls latencyStat
+	ts.mergeFlushLatency(flushSyncfs, &ls)
+	if ts.flushLatency != nil {
+		t.Error(ts.flushLatency)
+	}
+
+	ls.add(time.Millisecond)
+	ls.add(3 * time.Millisecond)
+	ts.addFlushLatency(flushSyncfs, 2*time.Millisecond)
+	ts.mergeFlushLatency(flushSyncfs, &ls)
+	x := &ts.flushLatency[flushSyncfs]
+	if x.Count != 3 || x.Min != uint64(time.Millisecond) ||
+		x.Max != uint64(3*time.Millisecond) || x.mean() != 2*time.Millisecond {
+		t.Error(x.Count, x.Min, x.Max, x.mean())
+	}
+	if ts.flushLatency[flushFsync].Count != 0 {
+		t.Error(ts.flushLatency[flushFsync])
+	}
+}
@@ -0,0 +1,674 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	straceAtFdcwd = -100
+)
+
+// straceCall is a system call in strace output.
+type straceCall struct {
+	name string
+	args []string
+	ret  int64
+	err  string // errno and message if failed
+	dur  time.Duration
+}
+
+// straceFd is an open file description, shared by fds of dup(2) and
+// by fd tables of forked processes.
+type straceFd struct {
+	path   string
+	off    int64
+	append bool
+}
+
+// straceProc is a pid, whose fd table is shared with threads created with
+// CLONE_FILES, or copied to forked processes.
+type straceProc struct {
+	gid        uint
+	cwd        string
+	fds        map[int64]*straceFd
+	unfinished string
+	ts         time.Time
+}
+
+type straceConverter struct {
+	procs    map[int]*straceProc
+	recs     []traceRecord
+	lastTs   time.Time
+	day      time.Duration // added to time of day on midnight wrap
+	numCall  uint
+	numSkip  uint
+	numNoFd  uint
+	numProcs uint
+}
+
+var straceLineRegexp = regexp.MustCompile(`^(?:\[pid\s+(\d+)\]\s+|(\d+)\s+)?(\d+:\d+:\d+\.\d+|\d+\.\d+)\s+(.*)$`)
+var straceResumedRegexp = regexp.MustCompile(`^<\.\.\. \w+ resumed>\s*`)
+
+func newStraceConverter() *straceConverter {
+	return &straceConverter{
+		procs: make(map[int]*straceProc),
+	}
+}
+
+// parseStraceTime parses time of -tt or -ttt.
+func (this *straceConverter) parseStraceTime(s string) (time.Time, error) {
+	if !strings.Contains(s, ":") {
+		x, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		sec := int64(x)
+		return time.Unix(sec, int64((x-float64(sec))*1e9)).UTC(), nil
+	}
+
+	t, err := time.Parse("15:04:05.999999999", s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t = time.Date(1970, 1, 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(),
+		time.UTC).Add(this.day)
+	if !this.lastTs.IsZero() && t.Before(this.lastTs.Add(-12*time.Hour)) {
+		this.day += 24 * time.Hour
+		t = t.Add(24 * time.Hour)
+	}
+	this.lastTs = t
+	return t, nil
+}
+
+// splitStraceArgs splits s after "(" at top level commas, and returns
+// the arguments and the rest after ")". Path annotation of -y after
+// fd like 3</path> is skipped as is.
+func splitStraceArgs(s string) ([]string, string, error) {
+	var args []string
+	depth := 0
+	quoted := false
+	begin := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quoted {
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				quoted = false
+			}
+			continue
+		}
+		switch c {
+		case '<':
+			if i > 0 && s[i-1] >= '0' && s[i-1] <= '9' {
+				if j := strings.Index(s[i:], ">"); j != -1 {
+					i += j
+				}
+			}
+		case '"':
+			quoted = true
+		case '(', '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		case ')':
+			if depth == 0 {
+				if x := strings.TrimSpace(s[begin:i]); len(x) != 0 || len(args) != 0 {
+					args = append(args, x)
+				}
+				return args, s[i+1:], nil
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(s[begin:i]))
+				begin = i + 1
+			}
+		}
+	}
+	return nil, "", fmt.Errorf("unterminated arguments")
+}
+
+// parseStraceCall parses "name(args) = ret [errno (msg)] [<dur>]".
+func parseStraceCall(s string) (*straceCall, error) {
+	i := strings.Index(s, "(")
+	if i <= 0 {
+		return nil, fmt.Errorf("no system call")
+	}
+	args, rest, err := splitStraceArgs(s[i+1:])
+	if err != nil {
+		return nil, err
+	}
+	x := &straceCall{
+		name: s[:i],
+		args: args,
+	}
+
+	rest = strings.TrimSpace(rest)
+	if !strings.HasPrefix(rest, "=") {
+		return nil, fmt.Errorf("no return value")
+	}
+	rest = strings.TrimSpace(rest[1:])
+	if j := strings.LastIndex(rest, " <"); j != -1 && strings.HasSuffix(rest, ">") {
+		if d, err := strconv.ParseFloat(rest[j+2:len(rest)-1], 64); err == nil {
+			x.dur = time.Duration(d * float64(time.Second))
+			rest = rest[:j]
+		}
+	}
+	v := strings.SplitN(rest, " ", 2)
+	if x.ret, err = parseStraceInt(v[0]); err != nil {
+		return nil, err
+	}
+	if x.ret < 0 && len(v) == 2 {
+		x.err = strings.TrimSpace(v[1])
+	}
+	return x, nil
+}
+
+// parseStraceInt parses an integer, ignoring -y annotation like 3</path>.
+func parseStraceInt(s string) (int64, error) {
+	if s == "AT_FDCWD" {
+		return straceAtFdcwd, nil
+	}
+	if i := strings.Index(s, "<"); i > 0 {
+		s = s[:i]
+	}
+	return strconv.ParseInt(s, 0, 64)
+}
+
+// parseStracePath unquotes a path, which must not be truncated by strace
+// as it would be a different path.
+func parseStracePath(s string) (string, error) {
+	if !strings.HasPrefix(s, "\"") {
+		return "", fmt.Errorf("invalid path %s", s)
+	}
+	if strings.HasSuffix(s, "\"...") {
+		return "", fmt.Errorf("truncated path %s, rerun strace with larger -s", s)
+	}
+	return strconv.Unquote(s)
+}
+
+func (this *straceConverter) getProc(pid int) *straceProc {
+	x, ok := this.procs[pid]
+	if !ok {
+		x = &straceProc{
+			gid: this.numProcs,
+			fds: make(map[int64]*straceFd),
+		}
+		this.procs[pid] = x
+		this.numProcs++
+	}
+	return x
+}
+
+// resolvePath resolves path relative to dirfd or cwd if known.
+func (this *straceConverter) resolvePath(proc *straceProc, dirfd int64, f string) string {
+	if filepath.IsAbs(f) {
+		return filepath.Clean(f)
+	}
+	if dirfd == straceAtFdcwd {
+		if len(proc.cwd) != 0 {
+			return filepath.Join(proc.cwd, f)
+		}
+	} else if fd, ok := proc.fds[dirfd]; ok {
+		return filepath.Join(fd.path, f)
+	}
+	return filepath.Clean(f)
+}
+
+func (this *straceConverter) emit(proc *straceProc, ts time.Time, c *straceCall,
+	op string, f string, newf string, off int64, siz int64) {
+	x := traceRecord{
+		Ts:       ts,
+		Gid:      proc.gid,
+		Op:       op,
+		Path:     f,
+		NewPath:  newf,
+		Offset:   off,
+		Size:     siz,
+		Result:   traceResultOk,
+		Duration: int64(c.dur),
+	}
+	if len(c.err) != 0 {
+		x.Result = c.err
+	}
+	this.recs = append(this.recs, x)
+}
+
+func (this *straceConverter) getArg(c *straceCall, i int) (string, error) {
+	if i >= len(c.args) {
+		return "", fmt.Errorf("%s: missing argument %d", c.name, i)
+	}
+	return c.args[i], nil
+}
+
+func (this *straceConverter) getArgInt(c *straceCall, i int) (int64, error) {
+	s, err := this.getArg(c, i)
+	if err != nil {
+		return -1, err
+	}
+	return parseStraceInt(s)
+}
+
+// getArgPath returns a resolved path of argument i, with dirfd argument
+// if dirfdIndex is not -1.
+func (this *straceConverter) getArgPath(proc *straceProc, c *straceCall, dirfdIndex int,
+	i int) (string, error) {
+	dirfd := int64(straceAtFdcwd)
+	if dirfdIndex != -1 {
+		x, err := this.getArgInt(c, dirfdIndex)
+		if err != nil {
+			return "", err
+		}
+		dirfd = x
+	}
+	s, err := this.getArg(c, i)
+	if err != nil {
+		return "", err
+	}
+	f, err := parseStracePath(s)
+	if err != nil {
+		return "", err
+	}
+	if len(f) == 0 && dirfd != straceAtFdcwd {
+		// AT_EMPTY_PATH
+		if fd, ok := proc.fds[dirfd]; ok {
+			return fd.path, nil
+		}
+		return "", nil
+	}
+	return this.resolvePath(proc, dirfd, f), nil
+}
+
+func (this *straceConverter) getArgFd(proc *straceProc, c *straceCall, i int) (*straceFd, error) {
+	n, err := this.getArgInt(c, i)
+	if err != nil {
+		return nil, err
+	}
+	fd, ok := proc.fds[n]
+	if !ok {
+		this.numNoFd++
+	}
+	return fd, nil
+}
+
+func (this *straceConverter) convertOpen(proc *straceProc, ts time.Time, c *straceCall,
+	dirfdIndex int, pathIndex int, flags string) error {
+	f, err := this.getArgPath(proc, c, dirfdIndex, pathIndex)
+	if err != nil {
+		return err
+	}
+	if c.ret < 0 {
+		this.emit(proc, ts, c, "stat", f, "", 0, 0)
+		return nil
+	}
+	proc.fds[c.ret] = &straceFd{
+		path:   f,
+		append: strings.Contains(flags, "O_APPEND"),
+	}
+	if strings.Contains(flags, "O_CREAT") {
+		this.emit(proc, ts, c, "create", f, "", 0, 0)
+	} else {
+		this.emit(proc, ts, c, "stat", f, "", 0, 0)
+	}
+	if strings.Contains(flags, "O_TRUNC") && !strings.Contains(flags, "O_RDONLY") {
+		this.emit(proc, ts, c, "truncate", f, "", 0, 0)
+	}
+	return nil
+}
+
+// forkProc sets up a child process or thread of pid created by parent.
+// The child may already have appeared before the parent returns.
+func (this *straceConverter) forkProc(parent *straceProc, pid int, sharesFiles bool) {
+	child := this.getProc(pid)
+	if len(child.cwd) == 0 {
+		child.cwd = parent.cwd
+	}
+	if sharesFiles {
+		for n, fd := range child.fds {
+			if _, ok := parent.fds[n]; !ok {
+				parent.fds[n] = fd
+			}
+		}
+		child.fds = parent.fds
+	} else {
+		for n, fd := range parent.fds {
+			if _, ok := child.fds[n]; !ok {
+				child.fds[n] = fd // shares offset
+			}
+		}
+	}
+}
+
+func (this *straceConverter) convertCall(proc *straceProc, ts time.Time, c *straceCall) error {
+	switch c.name {
+	case "clone", "clone3", "fork", "vfork":
+		if c.ret > 0 {
+			sharesFiles := false
+			for _, s := range c.args {
+				if strings.Contains(s, "CLONE_FILES") {
+					sharesFiles = true
+				}
+			}
+			this.forkProc(proc, int(c.ret), sharesFiles)
+		}
+	case "open":
+		flags, err := this.getArg(c, 1)
+		if err != nil {
+			return err
+		}
+		return this.convertOpen(proc, ts, c, -1, 0, flags)
+	case "creat":
+		return this.convertOpen(proc, ts, c, -1, 0, "O_WRONLY|O_CREAT|O_TRUNC")
+	case "openat":
+		flags, err := this.getArg(c, 2)
+		if err != nil {
+			return err
+		}
+		return this.convertOpen(proc, ts, c, 0, 1, flags)
+	case "close":
+		if c.ret == 0 {
+			n, err := this.getArgInt(c, 0)
+			if err != nil {
+				return err
+			}
+			delete(proc.fds, n)
+		}
+	case "dup", "dup2", "dup3":
+		if c.ret >= 0 {
+			fd, err := this.getArgFd(proc, c, 0)
+			if err != nil {
+				return err
+			} else if fd != nil {
+				proc.fds[c.ret] = fd // shares offset
+			}
+		}
+	case "lseek":
+		if c.ret >= 0 {
+			fd, err := this.getArgFd(proc, c, 0)
+			if err != nil {
+				return err
+			} else if fd != nil {
+				fd.off = c.ret
+			}
+		}
+	case "read", "write":
+		if c.ret < 0 {
+			break
+		}
+		fd, err := this.getArgFd(proc, c, 0)
+		if err != nil {
+			return err
+		} else if fd == nil {
+			break
+		}
+		off := fd.off
+		if c.name == "write" && fd.append {
+			off = -1
+		}
+		this.emit(proc, ts, c, c.name, fd.path, "", off, c.ret)
+		fd.off += c.ret
+	case "pread64", "pwrite64":
+		if c.ret < 0 {
+			break
+		}
+		fd, err := this.getArgFd(proc, c, 0)
+		if err != nil {
+			return err
+		} else if fd == nil {
+			break
+		}
+		off, err := this.getArgInt(c, 3)
+		if err != nil {
+			return err
+		}
+		op := "read"
+		if c.name == "pwrite64" {
+			op = "write"
+		}
+		this.emit(proc, ts, c, op, fd.path, "", off, c.ret)
+	case "stat", "lstat", "access":
+		f, err := this.getArgPath(proc, c, -1, 0)
+		if err != nil {
+			return err
+		}
+		this.emit(proc, ts, c, "stat", f, "", 0, 0)
+	case "newfstatat", "fstatat64", "statx", "faccessat", "faccessat2":
+		f, err := this.getArgPath(proc, c, 0, 1)
+		if err != nil {
+			return err
+		} else if len(f) != 0 {
+			this.emit(proc, ts, c, "stat", f, "", 0, 0)
+		}
+	case "mkdir", "unlink", "rmdir":
+		f, err := this.getArgPath(proc, c, -1, 0)
+		if err != nil {
+			return err
+		}
+		op := c.name
+		if op == "rmdir" {
+			op = "unlink"
+		}
+		this.emit(proc, ts, c, op, f, "", 0, 0)
+	case "mkdirat", "unlinkat":
+		f, err := this.getArgPath(proc, c, 0, 1)
+		if err != nil {
+			return err
+		}
+		this.emit(proc, ts, c, strings.TrimSuffix(c.name, "at"), f, "", 0, 0)
+	case "rename":
+		f, err := this.getArgPath(proc, c, -1, 0)
+		if err != nil {
+			return err
+		}
+		newf, err := this.getArgPath(proc, c, -1, 1)
+		if err != nil {
+			return err
+		}
+		this.emit(proc, ts, c, "rename", f, newf, 0, 0)
+	case "renameat", "renameat2":
+		f, err := this.getArgPath(proc, c, 0, 1)
+		if err != nil {
+			return err
+		}
+		newf, err := this.getArgPath(proc, c, 2, 3)
+		if err != nil {
+			return err
+		}
+		this.emit(proc, ts, c, "rename", f, newf, 0, 0)
+	case "fsync", "fdatasync":
+		fd, err := this.getArgFd(proc, c, 0)
+		if err != nil {
+			return err
+		} else if fd != nil {
+			this.emit(proc, ts, c, c.name, fd.path, "", 0, 0)
+		}
+	case "chdir":
+		if c.ret == 0 {
+			f, err := this.getArgPath(proc, c, -1, 0)
+			if err != nil {
+				return err
+			}
+			proc.cwd = f
+		}
+	case "fchdir":
+		if c.ret == 0 {
+			fd, err := this.getArgFd(proc, c, 0)
+			if err != nil {
+				return err
+			} else if fd != nil {
+				proc.cwd = fd.path
+			}
+		}
+	}
+	return nil
+}
+
+// convertLine converts a line of strace output, ignoring signals, exits
+// and unsupported system calls.
+func (this *straceConverter) convertLine(line string) error {
+	m := straceLineRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return nil
+	}
+	pid := 0
+	if s := m[1] + m[2]; len(s) != 0 {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		pid = n
+	}
+	ts, err := this.parseStraceTime(m[3])
+	if err != nil {
+		return err
+	}
+	body := m[4]
+	if strings.HasPrefix(body, "---") || strings.HasPrefix(body, "+++") {
+		return nil
+	}
+	proc := this.getProc(pid)
+
+	// join unfinished and resumed lines
+	if strings.HasSuffix(body, "<unfinished ...>") {
+		proc.unfinished = strings.TrimSuffix(body, "<unfinished ...>")
+		proc.ts = ts
+		return nil
+	}
+	if loc := straceResumedRegexp.FindStringIndex(body); loc != nil {
+		if len(proc.unfinished) == 0 {
+			return nil
+		}
+		body = proc.unfinished + body[loc[1]:]
+		ts = proc.ts
+		proc.unfinished = ""
+	}
+
+	c, err := parseStraceCall(body)
+	if err != nil {
+		this.numSkip++
+		return nil // e.g. exit_group() = ?
+	}
+	this.numCall++
+	return this.convertCall(proc, ts, c)
+}
+
+// getStraceRoot returns the deepest common directory of absolute paths.
+func getStraceRoot(recs []traceRecord) string {
+	var root []string
+	found := false
+	for _, x := range recs {
+		for _, f := range []string{x.Path, x.NewPath} {
+			if !filepath.IsAbs(f) {
+				continue
+			}
+			l := strings.Split(filepath.Dir(f), "/")
+			if !found {
+				root = l
+				found = true
+				continue
+			}
+			n := 0
+			for n < len(root) && n < len(l) && root[n] == l[n] {
+				n++
+			}
+			root = root[:n]
+		}
+	}
+	if !found {
+		return ""
+	}
+	s := strings.Join(root, "/")
+	if len(s) == 0 {
+		return "/"
+	}
+	return s
+}
+
+// rebaseStracePath returns a path relative to root, or false if outside.
+func rebaseStracePath(root string, f string) (string, bool) {
+	if len(f) == 0 || !filepath.IsAbs(f) {
+		return f, true
+	}
+	x, err := filepath.Rel(root, f)
+	if err != nil || x == ".." || strings.HasPrefix(x, "../") {
+		return "", false
+	}
+	return x, true
+}
+
+func runStraceImport(f string, output string, root string) error {
+	if len(output) == 0 {
+		return fmt.Errorf("empty strace output path")
+	}
+	fp, err := os.Open(f)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	this := newStraceConverter()
+	scanner := bufio.NewScanner(fp)
+	scanner.Buffer(make([]byte, 1<<16), 1<<24)
+	for i := 1; scanner.Scan(); i++ {
+		if err := this.convertLine(scanner.Text()); err != nil {
+			return fmt.Errorf("%s:%d: %s", f, i, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// rebase paths on root, records outside root are dropped
+	if len(root) == 0 {
+		root = getStraceRoot(this.recs)
+	} else {
+		root = filepath.Clean(root)
+	}
+	var recs []traceRecord
+	numOutside := 0
+	for _, x := range this.recs {
+		var ok1, ok2 bool
+		x.Path, ok1 = rebaseStracePath(root, x.Path)
+		x.NewPath, ok2 = rebaseStracePath(root, x.NewPath)
+		if ok1 && ok2 {
+			recs = append(recs, x)
+		} else {
+			numOutside++
+		}
+	}
+
+	ofp, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer ofp.Close()
+	w := bufio.NewWriter(ofp)
+	enc := json.NewEncoder(w)
+	for i := range recs {
+		if err := enc.Encode(&recs[i]); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := ofp.Close(); err != nil {
+		return err
+	}
+
+	fmt.Println("root", root)
+	fmt.Println(this.numCall, "system calls of", this.numProcs, "processes")
+	fmt.Println(numOutside, "records outside root,", this.numNoFd, "unknown fds,",
+		this.numSkip, "lines skipped")
+	fmt.Println("Wrote", len(recs), "records to", output)
+	return nil
+}
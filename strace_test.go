@@ -0,0 +1,230 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_splitStraceArgs(t *testing.T) {
+	validList := []struct {
+		s    string
+		args []string
+		rest string
+	}{
+		{`) = 0`, nil, ` = 0`},
+		{`3) = 0`, []string{"3"}, ` = 0`},
+		{`AT_FDCWD, "/a/b", O_RDONLY) = 3`, []string{"AT_FDCWD", `"/a/b"`, "O_RDONLY"}, ` = 3`},
+		{`"a,b)\"c", 1) = 0`, []string{`"a,b)\"c"`, "1"}, ` = 0`},
+		{`3</a, "b>, "x"..., 4096) = 1`, []string{`3</a, "b>`, `"x"...`, "4096"}, ` = 1`},
+		{`{st_mode=S_IFREG, st_size=1}, [1, 2], f(1, 2)) = 0`,
+			[]string{"{st_mode=S_IFREG, st_size=1}", "[1, 2]", "f(1, 2)"}, ` = 0`},
+	}
+	for _, x := range validList {
+		args, rest, err := splitStraceArgs(x.s)
+		if err != nil || rest != x.rest || len(args) != len(x.args) {
+			t.Error(x.s, args, rest, err)
+			continue
+		}
+		for i := range args {
+			if args[i] != x.args[i] {
+				t.Error(x.s, i, args[i])
+			}
+		}
+	}
+
+	invalidList := []string{
+		``,
+		`1, 2`,
+		`"a)`,
+	}
+	for _, s := range invalidList {
+		if args, rest, err := splitStraceArgs(s); err == nil {
+			t.Error(s, args, rest)
+		}
+	}
+}
+
+func Test_parseStraceCall(t *testing.T) {
+	validList := []struct {
+		s    string
+		name string
+		narg int
+		ret  int64
+		err  string
+		dur  time.Duration
+	}{
+		{`close(3) = 0`, "close", 1, 0, "", 0},
+		{`close(3)                = 0 <0.000005>`, "close", 1, 0, "", 5 * time.Microsecond},
+		{`openat(AT_FDCWD, "/a", O_RDONLY) = 3</a> <0.000010>`, "openat", 3, 3, "", 10 * time.Microsecond},
+		{`stat("/a", 0x7ffd) = -1 ENOENT (No such file or directory) <0.000004>`,
+			"stat", 2, -1, "ENOENT (No such file or directory)", 4 * time.Microsecond},
+		{`mmap(NULL, 8192, PROT_READ, MAP_PRIVATE, 3, 0) = 0x7f0000000000`, "mmap", 6, 0x7f0000000000, "", 0},
+	}
+	for _, x := range validList {
+		c, err := parseStraceCall(x.s)
+		if err != nil {
+			t.Error(x.s, err)
+		} else if c.name != x.name || len(c.args) != x.narg || c.ret != x.ret ||
+			c.err != x.err || c.dur != x.dur {
+			t.Error(x.s, c)
+		}
+	}
+
+	invalidList := []string{
+		``,
+		`close`,
+		`(3) = 0`,
+		`close(3)`,
+		`exit_group(0) = ?`,
+	}
+	for _, s := range invalidList {
+		if c, err := parseStraceCall(s); err == nil {
+			t.Error(s, c)
+		}
+	}
+}
+
+func Test_straceConverter(t *testing.T) {
+	lines := []string{
+		`1000  10:20:30.100000 chdir("/srv")       = 0 <0.000005>`,
+		`1000  10:20:30.100100 openat(AT_FDCWD, "a", O_WRONLY|O_CREAT|O_TRUNC, 0644) = 3 <0.000010>`,
+		`1000  10:20:30.100200 write(3, "xxx", 3) = 3 <0.000010>`,
+		`1000  10:20:30.100300 write(3, "xxx", 3) = 3 <0.000010>`,
+		`1000  10:20:30.100400 lseek(3, 1, SEEK_SET) = 1 <0.000010>`,
+		`1000  10:20:30.100450 clone(child_stack=0x7f0000000000, flags=CLONE_VM|CLONE_FS|CLONE_FILES|CLONE_SIGHAND|CLONE_THREAD|CLONE_SYSVSEM) = 1001`,
+		`[pid  1001] 10:20:30.100500 read(3,  <unfinished ...>`,
+		`[pid  1001] 10:20:30.100600 <... read resumed>"x", 1) = 1 <0.000010>`,
+		`1000  10:20:30.100610 clone(child_stack=NULL, flags=CLONE_CHILD_CLEARTID|CLONE_CHILD_SETTID|SIGCHLD, child_tidptr=0x7f0000000000) = 1002`,
+		`[pid  1002] 10:20:30.100620 close(3) = 0`,
+		`[pid  1002] 10:20:30.100630 openat(AT_FDCWD, "d", O_RDONLY) = 3`,
+		`[pid  1002] 10:20:30.100640 read(3, "x", 1) = 1`,
+		`1000  10:20:30.100650 write(3, "x", 1) = 1`,
+		`1000  10:20:30.100700 close(3)                = 0 <0.000005>`,
+		`1000  10:20:30.100800 write(3, "x", 1) = 1 <0.000010>`,
+		`1000  10:20:30.100900 --- SIGCHLD {si_signo=SIGCHLD} ---`,
+		`1000  23:59:59.000000 unlink("b") = 0 <0.000010>`,
+		`1000  00:00:01.000000 unlink("c") = -1 ENOENT (No such file or directory) <0.000010>`,
+	}
+	expected := []traceRecord{
+		{Gid: 0, Op: "create", Path: "/srv/a"},
+		{Gid: 0, Op: "truncate", Path: "/srv/a"},
+		{Gid: 0, Op: "write", Path: "/srv/a", Offset: 0, Size: 3},
+		{Gid: 0, Op: "write", Path: "/srv/a", Offset: 3, Size: 3},
+		{Gid: 1, Op: "read", Path: "/srv/a", Offset: 1, Size: 1},
+		{Gid: 2, Op: "stat", Path: "/srv/d"},
+		{Gid: 2, Op: "read", Path: "/srv/d", Offset: 0, Size: 1},
+		{Gid: 0, Op: "write", Path: "/srv/a", Offset: 2, Size: 1},
+		{Gid: 0, Op: "unlink", Path: "/srv/b"},
+		{Gid: 0, Op: "unlink", Path: "/srv/c"},
+	}
+
+	this := newStraceConverter()
+	for _, s := range lines {
+		if err := this.convertLine(s); err != nil {
+			t.Error(s, err)
+		}
+	}
+	if len(this.recs) != len(expected) {
+		t.Error(this.recs)
+		return
+	}
+	for i, x := range expected {
+		r := this.recs[i]
+		if r.Gid != x.Gid || r.Op != x.Op || r.Path != x.Path ||
+			r.Offset != x.Offset || r.Size != x.Size {
+			t.Error(i, r)
+		}
+	}
+	if this.numNoFd != 1 {
+		t.Error(this.numNoFd)
+	}
+	if r := this.recs[len(this.recs)-1]; r.Result == traceResultOk ||
+		r.Ts.Sub(this.recs[len(this.recs)-2].Ts) != 2*time.Second {
+		t.Error(r)
+	}
+}
+
+func Test_getStraceRoot(t *testing.T) {
+	rootList := []struct {
+		l    []string
+		root string
+	}{
+		{nil, ""},
+		{[]string{"a"}, ""},
+		{[]string{"/a"}, "/"},
+		{[]string{"/a/b"}, "/a"},
+		{[]string{"/a/b/c", "/a/b/d"}, "/a/b"},
+		{[]string{"/a/b/c", "/a/bb/d"}, "/a"},
+		{[]string{"/a/b/c", "x", "/a/b/d/e"}, "/a/b"},
+		{[]string{"/a/b/c", "/x/y"}, "/"},
+	}
+	for _, x := range rootList {
+		var recs []traceRecord
+		for _, f := range x.l {
+			recs = append(recs, traceRecord{Path: f})
+		}
+		if s := getStraceRoot(recs); s != x.root {
+			t.Error(x.l, s)
+		}
+	}
+}
+
+func Test_rebaseStracePath(t *testing.T) {
+	pathList := []struct {
+		root string
+		f    string
+		x    string
+		ok   bool
+	}{
+		{"/a", "", "", true},
+		{"/a", "b", "b", true},
+		{"/a", "/a", ".", true},
+		{"/a", "/a/b", "b", true},
+		{"/", "/a/b", "a/b", true},
+		{"/a", "/b", "", false},
+		{"/a", "/ab", "", false},
+	}
+	for _, x := range pathList {
+		if s, ok := rebaseStracePath(x.root, x.f); s != x.x || ok != x.ok {
+			t.Error(x, s, ok)
+		}
+	}
+}
+
+func Test_parseStracePath(t *testing.T) {
+	validList := []struct {
+		s string
+		f string
+	}{
+		{`""`, ""},
+		{`"/a/b"`, "/a/b"},
+		{`"a..."`, "a..."},
+		{`"a\"b"`, `a"b`},
+		{`"\303\244"`, "ä"},
+	}
+	for _, x := range validList {
+		if f, err := parseStracePath(x.s); err != nil || f != x.f {
+			t.Error(x, f, err)
+		}
+	}
+
+	invalidList := []string{
+		``,
+		`a`,
+		`"a`,
+		`"/path/to/a/long/directory/name"...`,
+	}
+	for _, s := range invalidList {
+		if f, err := parseStracePath(s); err == nil {
+			t.Error(s, f)
+		}
+	}
+
+	// conversion fails rather than operating on a wrong path
+	this := newStraceConverter()
+	if err := this.convertLine(`10:20:30.100000 unlink("/path/to/a/long/directory/name"...) = 0`); err == nil ||
+		!strings.Contains(err.Error(), "-s") || len(this.recs) != 0 {
+		t.Error(err, this.recs)
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type sweepParam struct {
+	name   string
+	values []string
+}
+
+type sweepRow struct {
+	values []string
+	set    int
+	mibs   float64
+	ops    float64
+	lat    latencyStat
+}
+
+func isIntOption(name string) (bool, error) {
+	f := flag.Lookup(name)
+	if f == nil {
+		return false, fmt.Errorf("no such option %s", name)
+	}
+	switch f.Value.(flag.Getter).Get().(type) {
+	case int, int64:
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// expandSweepValues expands comma separated values, each of which can be
+// a range <start>..<end> with optional +<step> or *<factor>. Values of
+// integer options are normalized, other values are kept as is unless a
+// range, so that size options take either a range or size distributions.
+func expandSweepValues(s string, isInt bool) ([]string, error) {
+	var l []string
+	for _, x := range strings.Split(s, ",") {
+		if len(x) == 0 {
+			return nil, fmt.Errorf("empty value in %s", s)
+		}
+		if !strings.Contains(x, "..") {
+			if isInt {
+				if n, err := parseSize(x); err != nil {
+					return nil, err
+				} else {
+					x = strconv.FormatInt(n, 10)
+				}
+			}
+			l = append(l, x)
+			continue
+		}
+		v := strings.SplitN(x, "..", 2)
+		start, err := parseSize(v[0])
+		if err != nil {
+			return nil, err
+		}
+		end := v[1]
+		step := int64(1)
+		factor := int64(0) // arithmetic unless specified
+		if i := strings.IndexAny(end, "+*"); i != -1 {
+			n, err := parseSize(end[i+1:])
+			if err != nil {
+				return nil, err
+			}
+			if end[i] == '+' {
+				step = n
+			} else {
+				factor = n
+			}
+			end = end[:i]
+		}
+		last, err := parseSize(end)
+		if err != nil {
+			return nil, err
+		}
+		if step <= 0 || (factor != 0 && (factor < 2 || start <= 0)) {
+			return nil, fmt.Errorf("invalid range %s", x)
+		}
+		for n := start; n <= last; {
+			l = append(l, strconv.FormatInt(n, 10))
+			if factor != 0 {
+				n *= factor
+			} else {
+				n += step
+			}
+		}
+	}
+	if len(l) == 0 {
+		return nil, fmt.Errorf("no values in %s", s)
+	}
+	return l, nil
+}
+
+// parseSweep parses semicolon separated <option>=<values>.
+func parseSweep(s string) ([]sweepParam, error) {
+	var pv []sweepParam
+	for _, x := range strings.Split(s, ";") {
+		if len(x) == 0 {
+			continue
+		}
+		v := strings.SplitN(x, "=", 2)
+		if len(v) != 2 || len(v[0]) == 0 {
+			return nil, fmt.Errorf("invalid sweep parameter %s", x)
+		}
+		name := v[0]
+		if isProcessOption(name) {
+			return nil, fmt.Errorf("option \"%s\" not allowed in sweep", name)
+		}
+		for _, p := range pv {
+			if p.name == name {
+				return nil, fmt.Errorf("duplicate sweep parameter %s", name)
+			}
+		}
+		isInt, err := isIntOption(name)
+		if err != nil {
+			return nil, err
+		}
+		values, err := expandSweepValues(v[1], isInt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		pv = append(pv, sweepParam{name, values})
+	}
+	if len(pv) == 0 {
+		return nil, fmt.Errorf("no sweep parameters in %s", s)
+	}
+	return pv, nil
+}
+
+// getSweepCombinations returns cartesian product of parameter values,
+// with the last parameter changing fastest.
+func getSweepCombinations(pv []sweepParam) [][]string {
+	l := [][]string{{}}
+	for _, p := range pv {
+		var x [][]string
+		for _, c := range l {
+			for _, v := range p.values {
+				cc := make([]string, len(c), len(c)+1)
+				copy(cc, c)
+				x = append(x, append(cc, v))
+			}
+		}
+		l = x
+	}
+	return l
+}
+
+func newSweepRow(values []string, set int, tsv []threadStat) sweepRow {
+	x := sweepRow{
+		values: values,
+		set:    set,
+	}
+	for i := 0; i < len(tsv); i++ {
+		if sec := tsv[i].timeEnd.Sub(tsv[i].timeBegin).Seconds(); sec > 0 {
+			mib := float64(tsv[i].numReadBytes+tsv[i].numWriteBytes) / (1 << 20)
+			x.mibs += mib / sec
+			x.ops += float64(tsv[i].numRead+tsv[i].numWrite) / sec
+		}
+		x.lat.merge(&tsv[i].readLatency)
+		x.lat.merge(&tsv[i].writeLatency)
+	}
+	return x
+}
+
+func getSweepTable(pv []sweepParam, rv []sweepRow) ([]string, [][]string) {
+	var header []string
+	for _, p := range pv {
+		header = append(header, p.name)
+	}
+	header = append(header, "set", "MiB/sec", "op/sec", "lat_avg[us]",
+		"lat_p50[us]", "lat_p99[us]", "lat_max[us]")
+
+	us := func(d time.Duration) string {
+		return fmt.Sprintf("%.2f", float64(d)/float64(time.Microsecond))
+	}
+	var rows [][]string
+	for _, r := range rv {
+		var row []string
+		row = append(row, r.values...)
+		row = append(row, strconv.Itoa(r.set),
+			fmt.Sprintf("%.2f", r.mibs), fmt.Sprintf("%.2f", r.ops),
+			us(r.lat.mean()), us(r.lat.percentile(50)), us(r.lat.percentile(99)),
+			us(time.Duration(r.lat.Max)))
+		rows = append(rows, row)
+	}
+	return header, rows
+}
+
+func printSweepTable(header []string, rows [][]string) {
+	widths := make([]int, len(header))
+	for i, s := range header {
+		widths[i] = len(s)
+	}
+	for _, row := range rows {
+		for i, s := range row {
+			if len(s) > widths[i] {
+				widths[i] = len(s)
+			}
+		}
+	}
+
+	var l []string
+	for i, s := range header {
+		l = append(l, fmt.Sprintf("%-*s", widths[i], s))
+	}
+	s := strings.Join(l, " ")
+	fmt.Println(s)
+	fmt.Println(strings.Repeat("-", len(s)))
+	for _, row := range rows {
+		l = nil
+		for i, s := range row {
+			l = append(l, fmt.Sprintf("%*s", widths[i], s))
+		}
+		fmt.Println(strings.Join(l, " "))
+	}
+}
+
+func writeSweepCsv(f string, header []string, rows [][]string) error {
+	fp, err := os.Create(f)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	w := csv.NewWriter(fp)
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return err
+	}
+	return fp.Sync()
+}
+
+func runSweep(s string, input []string) error {
+	pv, err := parseSweep(s)
+	if err != nil {
+		return err
+	}
+	base := getOptions()
+	cv := getSweepCombinations(pv)
+
+	var rv []sweepRow
+	interrupted := false
+	for i, c := range cv {
+		m := make(map[string]string)
+		var l []string
+		for j, p := range pv {
+			m[p.name] = c[j]
+			l = append(l, fmt.Sprintf("%s=%s", p.name, c[j]))
+		}
+		fmt.Println(strings.Repeat("#", 80))
+		s := fmt.Sprintf("Sweep %d/%d %s", i+1, len(cv), strings.Join(l, " "))
+		fmt.Println(s)
+		dbg(s)
+
+		if err := setOptions(base); err != nil {
+			return err
+		}
+		if err := setOptions(m); err != nil {
+			return err
+		}
+		sv, err := runSets(input)
+		for j, x := range sv {
+			rv = append(rv, newSweepRow(c, j+1, x.Stats))
+			if x.NumInterrupted > 0 {
+				interrupted = true
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if interrupted {
+			break
+		}
+		fmt.Println()
+	}
+	if err := setOptions(base); err != nil {
+		return err
+	}
+
+	header, rows := getSweepTable(pv, rv)
+	fmt.Println(strings.Repeat("#", 80))
+	printSweepTable(header, rows)
+	if len(optSweepCsv) != 0 {
+		if err := writeSweepCsv(optSweepCsv, header, rows); err != nil {
+			return err
+		}
+		fmt.Println("Wrote", optSweepCsv)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_expandSweepValues(t *testing.T) {
+	validList := []struct {
+		s     string
+		isInt bool
+		l     []string
+	}{
+		{"1", true, []string{"1"}},
+		{"1,2,4", true, []string{"1", "2", "4"}},
+		{"4k,64k", true, []string{"4096", "65536"}},
+		{"1..4", true, []string{"1", "2", "3", "4"}},
+		{"0..10+5", true, []string{"0", "5", "10"}},
+		{"1..16*2", true, []string{"1", "2", "4", "8", "16"}},
+		{"4k..16k*2,1m", true, []string{"4096", "8192", "16384", "1048576"}},
+		{"walk,random", false, []string{"walk", "random"}},
+		{"true", false, []string{"true"}},
+		{"1k..4k*2", false, []string{"1024", "2048", "4096"}},
+		{"lognormal:4k:1,4k", false, []string{"lognormal:4k:1", "4k"}},
+	}
+	for _, x := range validList {
+		l, err := expandSweepValues(x.s, x.isInt)
+		if err != nil {
+			t.Error(x.s, err)
+			continue
+		}
+		if len(l) != len(x.l) {
+			t.Error(x.s, l)
+			continue
+		}
+		for i := range l {
+			if l[i] != x.l[i] {
+				t.Error(x.s, l)
+			}
+		}
+	}
+
+	invalidList := []struct {
+		s     string
+		isInt bool
+	}{
+		{"", true},
+		{"1,,2", true},
+		{"x", true},
+		{"1..x", true},
+		{"1..4+0", true},
+		{"1..4*1", true},
+		{"0..4*2", true},
+		{"4..1", true},
+		{"a..b", false},
+	}
+	for _, x := range invalidList {
+		if l, err := expandSweepValues(x.s, x.isInt); err == nil {
+			t.Error(x.s, l)
+		}
+	}
+}
+
+func Test_parseSweep(t *testing.T) {
+	pv, err := parseSweep("num_reader=1..2;read_size=1k..64k*4,lognormal:4k:1;path_iter=walk,random")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []sweepParam{
+		{"num_reader", []string{"1", "2"}},
+		{"read_size", []string{"1024", "4096", "16384", "65536", "lognormal:4k:1"}},
+		{"path_iter", []string{"walk", "random"}},
+	}
+	if len(pv) != len(expected) {
+		t.Error(pv)
+		return
+	}
+	for i := range pv {
+		if pv[i].name != expected[i].name || len(pv[i].values) != len(expected[i].values) {
+			t.Error(i, pv[i])
+			continue
+		}
+		for j := range pv[i].values {
+			if pv[i].values[j] != expected[i].values[j] {
+				t.Error(i, pv[i])
+			}
+		}
+	}
+
+	for _, s := range []string{"", "xxx=1", "num_reader=x", "num_reader=1;num_reader=2", "sweep=x"} {
+		if pv, err := parseSweep(s); err == nil {
+			t.Error(s, pv)
+		}
+	}
+}
+
+func Test_getSweepCombinations(t *testing.T) {
+	pv := []sweepParam{
+		{"a", []string{"1", "2"}},
+		{"b", []string{"x", "y", "z"}},
+	}
+	l := getSweepCombinations(pv)
+	if len(l) != 6 {
+		t.Error(l)
+		return
+	}
+	expected := [][]string{
+		{"1", "x"}, {"1", "y"}, {"1", "z"},
+		{"2", "x"}, {"2", "y"}, {"2", "z"}}
+	for i := range l {
+		if len(l[i]) != 2 || l[i][0] != expected[i][0] || l[i][1] != expected[i][1] {
+			t.Error(i, l[i])
+		}
+	}
+}
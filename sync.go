@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	syncOpenNone = iota
+	syncOpenSync
+	syncOpenDsync
+)
+
+const (
+	flushFsync = iota
+	flushFdatasync
+	flushSyncFileRange
+	flushSyncfs
+	flushOSync
+	flushODsync
+	flushMsync
+	numFlushType
+)
+
+var flushNames = []string{"fsync", "fdatasync", "sync_file_range", "syncfs",
+	"O_SYNC write", "O_DSYNC write", "msync"}
+
+// getSyncOpenFlag returns open flag for write paths by -sync_open.
+func getSyncOpenFlag() int {
+	switch optSyncOpen {
+	case syncOpenSync:
+		return os.O_SYNC
+	case syncOpenDsync:
+		return oDsync
+	default:
+		return 0
+	}
+}
+
+// writeSyncState counts writes since the last flush of a file.
+type writeSyncState struct {
+	numWrite uint
+	numBytes int64
+}
+
+// syncWritten is called after siz bytes written at off, or before the
+// current offset if off < 0, which took d. It records O_SYNC or O_DSYNC
+// write latency, and issues sync_file_range(2) or flush as specified.
+func syncWritten(fp *os.File, off int64, siz int, d time.Duration,
+	ws *writeSyncState, thr *gThread) error {
+	if fp == thr.dir.syncFile {
+		if optSyncOpen == syncOpenSync {
+			thr.stat.addFlushLatency(flushOSync, d)
+		} else {
+			thr.stat.addFlushLatency(flushODsync, d)
+		}
+	}
+
+	if optSyncFileRange {
+		if off < 0 {
+			cur, err := fp.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return err
+			}
+			off = cur - int64(siz)
+		}
+		t := time.Now()
+		err := syncFileRange(fp, off, int64(siz))
+		traceOp(thr, "sync_file_range", fp.Name(), off, int64(siz), err, t)
+		if err != nil {
+			return err
+		}
+		thr.stat.addFlushLatency(flushSyncFileRange, time.Since(t))
+	}
+
+	if optSyncEveryWrites == 0 && optSyncEveryBytes == 0 {
+		return nil
+	}
+	ws.numWrite++
+	ws.numBytes += int64(siz)
+	if (optSyncEveryWrites > 0 && ws.numWrite >= optSyncEveryWrites) ||
+		(optSyncEveryBytes > 0 && ws.numBytes >= optSyncEveryBytes) {
+		*ws = writeSyncState{}
+		return traceFlush(fp, thr)
+	}
+	return nil
+}
+
+// traceFlush is fsync(2) or fdatasync(2) by -sync_type.
+func traceFlush(fp *os.File, thr *gThread) error {
+	if optSyncType == flushFdatasync {
+		return traceFdatasync(fp, thr)
+	}
+	return traceSync(fp, thr)
+}
+
+// runSyncfs calls syncfs(2) on each input every interval until stopCh is
+// closed, and returns the latency.
+func runSyncfs(input []string, interval time.Duration, stopCh <-chan int) latencyStat {
+	var lat latencyStat
+	var fpv []*os.File
+	for _, f := range input {
+		fp, err := os.Open(f)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		defer fp.Close()
+		fpv = append(fpv, fp)
+	}
+
+	label := "[syncfs]"
+	tc := time.NewTicker(interval)
+	defer tc.Stop()
+	for {
+		select {
+		case <-stopCh:
+			dbg(label, "interrupt")
+			return lat
+		case <-tc.C:
+			for _, fp := range fpv {
+				t := time.Now()
+				if err := syncfs(fp); err != nil {
+					dbg(label, err)
+					fmt.Println(err)
+					continue
+				}
+				lat.add(time.Since(t))
+			}
+		}
+	}
+}
+
+func printFlushStat(tsv []threadStat) {
+	lat := make([]latencyStat, numFlushType)
+	for i := 0; i < len(tsv); i++ {
+		for j := 0; j < len(tsv[i].flushLatency) && j < len(lat); j++ {
+			lat[j].merge(&tsv[i].flushLatency[j])
+		}
+	}
+	for i := range lat {
+		if lat[i].Count == 0 {
+			continue
+		}
+		fmt.Printf("flush %s: %d latency avg %s p50 %s p99 %s max %s\n",
+			flushNames[i], lat[i].Count,
+			getLatencyString(lat[i].mean()), getLatencyString(lat[i].percentile(50)),
+			getLatencyString(lat[i].percentile(99)),
+			getLatencyString(time.Duration(lat[i].Max)))
+	}
+}
@@ -0,0 +1,15 @@
+//go:build linux && !arm
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+const syncFileRangeSupported = true
+
+// syncFileRange initiates writeback of n bytes at off without waiting.
+func syncFileRange(fp *os.File, off int64, n int64) error {
+	return syscall.SyncFileRange(int(fp.Fd()), off, n, 0x2) // SYNC_FILE_RANGE_WRITE
+}
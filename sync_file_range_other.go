@@ -0,0 +1,15 @@
+//go:build !linux || arm
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// syncFileRangeSupported is false where sync_file_range(2) is unavailable.
+const syncFileRangeSupported = false
+
+func syncFileRange(fp *os.File, off int64, n int64) error {
+	return fmt.Errorf("sync_file_range unsupported")
+}
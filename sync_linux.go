@@ -0,0 +1,21 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+const oDsync = syscall.O_DSYNC
+
+const syncfsSupported = true
+
+// syncfs flushes the filesystem which contains fp.
+func syncfs(fp *os.File) error {
+	_, _, e := syscall.Syscall(sysSyncfs, fp.Fd(), 0, 0)
+	if e != 0 {
+		return e
+	}
+	return nil
+}
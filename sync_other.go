@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// oDsync falls back to O_SYNC where O_DSYNC is unavailable.
+const oDsync = os.O_SYNC
+
+// syncfsSupported is false where syncfs(2) is unavailable.
+const syncfsSupported = false
+
+func syncfs(fp *os.File) error {
+	return fmt.Errorf("syncfs unsupported")
+}
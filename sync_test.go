@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_syncWritten(t *testing.T) {
+	everyWrites := optSyncEveryWrites
+	everyBytes := optSyncEveryBytes
+	syncType := optSyncType
+	defer func() {
+		optSyncEveryWrites = everyWrites
+		optSyncEveryBytes = everyBytes
+		optSyncType = syncType
+	}()
+
+	syncList := []struct {
+		everyWrites uint
+		everyBytes  int64
+		typ         int
+		n           uint64
+	}{
+		{0, 0, flushFsync, 0},
+		{3, 0, flushFsync, 3},
+		{0, 4096, flushFdatasync, 2},
+		{5, 2048, flushFdatasync, 5},
+		{20, 0, flushFsync, 0},
+	}
+	for i, x := range syncList {
+		optSyncEveryWrites = x.everyWrites
+		optSyncEveryBytes = x.everyBytes
+		optSyncType = x.typ
+
+		fp, err := os.Create(filepath.Join(t.TempDir(), "x"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		thr := newWrite(0, 1024)
+		if err := writeData(fp, 10*1024, &thr); err != nil {
+			t.Error(i, err)
+		}
+		fp.Close()
+		n := uint64(0)
+		if thr.stat.flushLatency != nil {
+			n = thr.stat.flushLatency[x.typ].Count
+		}
+		if n != x.n {
+			t.Error(i, n)
+		}
+	}
+}
@@ -0,0 +1,4 @@
+package main
+
+// syscall package lacks SYS_SYNCFS on 386.
+const sysSyncfs = 344
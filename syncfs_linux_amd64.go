@@ -0,0 +1,4 @@
+package main
+
+// syscall package lacks SYS_SYNCFS on amd64.
+const sysSyncfs = 306
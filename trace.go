@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	traceResultOk = "ok"
+)
+
+// traceRecord is a filesystem operation issued by a worker, written to
+// trace file as a line of JSON. Path is relative to input path of the
+// worker if under the input path. Offset is -1 for appending write.
+type traceRecord struct {
+	Ts       time.Time `json:"ts"`
+	Gid      uint      `json:"gid"`
+	Op       string    `json:"op"`
+	Path     string    `json:"path"`
+	NewPath  string    `json:"new_path,omitempty"`
+	Offset   int64     `json:"offset"`
+	Size     int64     `json:"size"`
+	Result   string    `json:"result"`
+	Duration int64     `json:"duration_ns"`
+}
+
+type traceWriter struct {
+	mtx    sync.Mutex
+	fp     *os.File
+	w      *bufio.Writer
+	enc    *json.Encoder
+	closed bool
+	err    error // first encode error, returned by closeTrace
+}
+
+var (
+	tracer       atomic.Value // *traceWriter, loaded by workers without lock
+	traceOpened  bool         // trace file truncated on first open
+	traceOpenMtx sync.Mutex
+)
+
+func getTracer() *traceWriter {
+	tw, _ := tracer.Load().(*traceWriter)
+	return tw
+}
+
+func getTraceFile() string {
+	// child processes write to their own files
+	if isChildProcess() {
+		return fmt.Sprintf("%s.%d", optTraceFile, childIndex)
+	}
+	return optTraceFile
+}
+
+func openTrace() error {
+	traceOpenMtx.Lock()
+	defer traceOpenMtx.Unlock()
+	assert(getTracer() == nil)
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if !traceOpened {
+		flags |= os.O_TRUNC
+	}
+	fp, err := os.OpenFile(getTraceFile(), flags, 0644)
+	if err != nil {
+		return err
+	}
+	traceOpened = true
+
+	w := bufio.NewWriter(fp)
+	tracer.Store(&traceWriter{
+		fp:  fp,
+		w:   w,
+		enc: json.NewEncoder(w),
+	})
+	return nil
+}
+
+func closeTrace() error {
+	traceOpenMtx.Lock()
+	defer traceOpenMtx.Unlock()
+	this := getTracer()
+	if this == nil {
+		return nil
+	}
+	tracer.Store((*traceWriter)(nil))
+
+	// workers which loaded the tracer before above see it closed
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+	this.closed = true
+	if err := this.w.Flush(); err != nil {
+		this.fp.Close()
+		return err
+	}
+	if err := this.fp.Close(); err != nil {
+		return err
+	}
+	return this.err
+}
+
+func getTracePath(thr *gThread, f string) string {
+	if len(f) == 0 {
+		return f
+	}
+	x, err := filepath.Rel(thr.stat.inputPath, f)
+	if err != nil || x == ".." || strings.HasPrefix(x, "../") {
+		return f
+	}
+	return x
+}
+
+func getTraceResult(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return traceResultOk
+}
+
+// traceOp records an operation which started at t.
+func traceOp(thr *gThread, op string, f string, off int64, siz int64, err error, t time.Time) {
+	traceRenameOp(thr, op, f, "", off, siz, err, t)
+}
+
+func traceRenameOp(thr *gThread, op string, f string, newf string, off int64, siz int64,
+	err error, t time.Time) {
+	tw := getTracer()
+	if tw == nil {
+		return
+	}
+	d := time.Since(t)
+	x := traceRecord{
+		Ts:       t,
+		Gid:      thr.gid,
+		Op:       op,
+		Path:     getTracePath(thr, f),
+		NewPath:  getTracePath(thr, newf),
+		Offset:   off,
+		Size:     siz,
+		Result:   getTraceResult(err),
+		Duration: int64(d),
+	}
+
+	tw.mtx.Lock()
+	defer tw.mtx.Unlock()
+	if tw.closed || tw.err != nil {
+		return
+	}
+	if err := tw.enc.Encode(&x); err != nil {
+		dbg(err)
+		tw.err = fmt.Errorf("%s: %w", tw.fp.Name(), err) // stop tracing
+	}
+}
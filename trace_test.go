@@ -0,0 +1,57 @@
+package main
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_closeTrace(t *testing.T) {
+	traceFile := optTraceFile
+	defer func() {
+		optTraceFile = traceFile
+	}()
+	optTraceFile = filepath.Join(t.TempDir(), "trace.json")
+
+	// workers may trace while the trace file is closed
+	if err := openTrace(); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			thr := newRead(uint(i), 1024)
+			for j := 0; j < 1000; j++ {
+				traceOp(&thr, "stat", "f", 0, 0, nil, time.Now())
+			}
+		}(i)
+	}
+	if err := closeTrace(); err != nil {
+		t.Error(err)
+	}
+	wg.Wait()
+	if tw := getTracer(); tw != nil {
+		t.Error(tw)
+	}
+	if _, err := loadTraceFile(optTraceFile); err != nil {
+		t.Error(err)
+	}
+
+	// encode error is returned on close
+	if err := openTrace(); err != nil {
+		t.Fatal(err)
+	}
+	if err := getTracer().fp.Close(); err != nil {
+		t.Fatal(err)
+	}
+	thr := newRead(0, 1024)
+	for j := 0; j < 1000; j++ {
+		traceOp(&thr, "stat", "f", 0, 0, nil, time.Now())
+	}
+	if err := closeTrace(); err == nil {
+		t.Error("no error")
+	}
+}
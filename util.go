@@ -6,6 +6,7 @@ import (
 	"os"
 	"path"
 	"runtime"
+	"strconv"
 	"strings"
 )
 
@@ -51,6 +52,7 @@ const (
 	typeUnsupported
 	typeInvalid
 	typeLink // hardlink
+	typeCopy // copy of regular file
 )
 
 func getRawFileType(f string) (fileType, error) {
@@ -115,6 +117,50 @@ func isDirWritable(f string) (bool, error) {
 	}
 }
 
+// parseSize parses size with optional k|m|g|t suffix in units of 1024.
+func parseSize(s string) (int64, error) {
+	if len(s) == 0 {
+		return -1, fmt.Errorf("empty size")
+	}
+	shift := 0
+	switch s[len(s)-1] {
+	case 'k', 'K':
+		shift = 10
+	case 'm', 'M':
+		shift = 20
+	case 'g', 'G':
+		shift = 30
+	case 't', 'T':
+		shift = 40
+	}
+	x := s
+	if shift != 0 {
+		x = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(x, 10, 64)
+	if err != nil {
+		return -1, fmt.Errorf("invalid size %s", s)
+	}
+	if n > 0 && n > (1<<62)>>shift {
+		return -1, fmt.Errorf("size %s too large", s)
+	}
+	return n << shift, nil
+}
+
+// formatSize is reverse of parseSize, using the largest suffix which
+// divides n.
+func formatSize(n int64) string {
+	if n != 0 {
+		for i, x := range []string{"t", "g", "m", "k"} {
+			shift := uint(40 - i*10)
+			if n%(1<<shift) == 0 {
+				return strconv.FormatInt(n>>shift, 10) + x
+			}
+		}
+	}
+	return strconv.FormatInt(n, 10)
+}
+
 func removeDupString(input []string) []string {
 	var l []string
 	for _, a := range input {
@@ -149,6 +149,67 @@ func Test_isDirWritable(t *testing.T) {
 	}
 }
 
+func Test_parseSize(t *testing.T) {
+	validList := []struct {
+		s string
+		n int64
+	}{
+		{"0", 0},
+		{"-1", -1},
+		{"1", 1},
+		{"512", 512},
+		{"4k", 4 << 10},
+		{"4K", 4 << 10},
+		{"64k", 64 << 10},
+		{"1m", 1 << 20},
+		{"16M", 16 << 20},
+		{"2g", 2 << 30},
+		{"1T", 1 << 40},
+	}
+	for _, x := range validList {
+		if n, err := parseSize(x.s); n != x.n || err != nil {
+			t.Error(x.s, n, err)
+		}
+	}
+
+	invalidList := []string{
+		"",
+		"k",
+		"4x",
+		"4kk",
+		"4 k",
+		"1.5m",
+		"9999999999999t"}
+	for _, s := range invalidList {
+		if n, err := parseSize(s); err == nil {
+			t.Error(s, n)
+		}
+	}
+}
+
+func Test_formatSize(t *testing.T) {
+	sizeList := []struct {
+		n int64
+		s string
+	}{
+		{0, "0"},
+		{1, "1"},
+		{1000, "1000"},
+		{4 << 10, "4k"},
+		{(1 << 20) + (1 << 10), "1025k"},
+		{16 << 20, "16m"},
+		{2 << 30, "2g"},
+		{1 << 40, "1t"},
+	}
+	for _, x := range sizeList {
+		if s := formatSize(x.n); s != x.s {
+			t.Error(x.n, s)
+		} else if n, err := parseSize(s); n != x.n || err != nil {
+			t.Error(s, n, err)
+		}
+	}
+}
+
 func Test_removeDupString(t *testing.T) {
 	uniqListList := [][]string{
 		{""},
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// webState is per reader state of web personality.
+// Files are ranked by a fixed permutation of flist which is the same
+// among readers, and the rank is chosen by Zipf distribution.
+type webState struct {
+	rank []int
+	zipf *rand.Zipf
+}
+
+func newWebState(n int, r *rand.Rand) *webState {
+	assert(n > 0)
+	return &webState{
+		rank: rand.New(rand.NewSource(int64(n))).Perm(n),
+		zipf: rand.NewZipf(r, optWebZipfExponent, 1, uint64(n-1)),
+	}
+}
+
+func webIndex(fl []string, thr *gThread) int {
+	if thr.dir.web == nil || len(thr.dir.web.rank) != len(fl) {
+		thr.dir.web = newWebState(len(fl), thr.rand)
+	}
+	return thr.dir.web.rank[thr.dir.web.zipf.Uint64()]
+}
+
+// webEntry serves a request by reading a whole file in one
+// open-read-close cycle.
+func webEntry(f string, thr *gThread) error {
+	assertFilePath(f)
+	t := time.Now()
+	fp, err := traceOpenFile(f, os.O_RDONLY, 0, thr)
+	if err != nil {
+		return err
+	}
+	siz, err := webReadFile(fp, thr)
+	if cerr := traceClose(fp, thr); err == nil {
+		err = cerr
+	}
+	if err != nil || siz < 0 {
+		return err
+	}
+
+	d := time.Since(t)
+	thr.stat.incNumOp()
+	thr.stat.addOpLatency(d)
+	thr.stat.addOpSizeLatency(siz, d)
+	return nil
+}
+
+// webReadFile reads fp until EOF, and returns the size read, or -1 if not
+// a regular file.
+func webReadFile(fp *os.File, thr *gThread) (int64, error) {
+	f := fp.Name()
+	ts := time.Now()
+	st, err := fp.Stat()
+	traceOp(thr, "stat", f, 0, 0, err, ts)
+	if err != nil {
+		return -1, err
+	}
+	thr.stat.incNumStat()
+	if !st.Mode().IsRegular() {
+		return -1, nil
+	}
+
+	b := thr.dir.readBuffer
+	siz := int64(0)
+	for {
+		tr := time.Now()
+		n, err := fp.Read(b)
+		thr.stat.addReadLatency(time.Since(tr))
+		if err == io.EOF {
+			traceOp(thr, "read", f, siz, int64(n), nil, tr)
+		} else {
+			traceOp(thr, "read", f, siz, int64(n), err, tr)
+		}
+		thr.stat.incNumRead()
+		thr.stat.addNumReadBytes(n)
+		siz += int64(n)
+		if err == io.EOF {
+			return siz, nil
+		} else if err != nil {
+			return -1, getDirectError(f, err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_webEntry(t *testing.T) {
+	traceFile := optTraceFile
+	readBufferSize := optReadBufferSize
+	defer func() {
+		optTraceFile = traceFile
+		optReadBufferSize = readBufferSize
+	}()
+	optTraceFile = filepath.Join(t.TempDir(), "trace.json")
+	optReadBufferSize = 1024
+
+	d := t.TempDir()
+	f := filepath.Join(d, "f")
+	if err := os.WriteFile(f, make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	thr := newRead(0, 1024)
+	thr.stat.setInputPath(d)
+	if err := openTrace(); err != nil {
+		t.Fatal(err)
+	}
+	err := webEntry(f, &thr)
+	if err := closeTrace(); err != nil {
+		t.Fatal(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thr.stat.numOp != 1 || thr.stat.numReadBytes != 100 {
+		t.Error(thr.stat.numOp, thr.stat.numReadBytes)
+	}
+
+	// a single open-read-close cycle
+	l, err := loadTraceFile(optTraceFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"open", "stat", "read", "read", "close"}
+	if len(l) != len(expected) {
+		t.Fatal(l)
+	}
+	for i, x := range l {
+		if x.Op != expected[i] || x.Path != "f" {
+			t.Error(i, x)
+		}
+	}
+}
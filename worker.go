@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -38,6 +39,7 @@ func (this *workerTimer) Error() string {
 
 type gThread struct {
 	gid            uint
+	rand           *rand.Rand
 	dir            threadDir
 	stat           threadStat
 	numComplete    uint
@@ -53,9 +55,140 @@ func (this *gThread) isWriter() bool {
 	return !this.isReader()
 }
 
+// workerControl lets other goroutines pause, resume or stop running workers.
+type workerControl struct {
+	mtx    sync.Mutex
+	cond   *sync.Cond
+	paused uint32 // set under mtx, read by workers without mtx
+	stopCh chan int
+	thrv   []gThread
+}
+
+var workerCtl = newWorkerControl()
+
+func newWorkerControl() *workerControl {
+	this := &workerControl{
+		stopCh: make(chan int, 1),
+	}
+	this.cond = sync.NewCond(&this.mtx)
+	return this
+}
+
+func (this *workerControl) begin(thrv []gThread) <-chan int {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+	atomic.StoreUint32(&this.paused, 0)
+	this.thrv = thrv
+	return this.stopCh
+}
+
+// end drops stop request sent after workers were interrupted.
+func (this *workerControl) end() {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+	atomic.StoreUint32(&this.paused, 0)
+	this.thrv = nil
+	this.cond.Broadcast()
+	select {
+	case <-this.stopCh:
+	default:
+	}
+}
+
+// reset drops pending stop request.
+func (this *workerControl) reset() {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+	select {
+	case <-this.stopCh:
+	default:
+	}
+}
+
+func (this *workerControl) isRunning() bool {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+	return this.thrv != nil
+}
+
+func (this *workerControl) isPaused() bool {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+	return this.paused != 0
+}
+
+func (this *workerControl) pause() bool {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+	if this.thrv == nil {
+		return false
+	}
+	atomic.StoreUint32(&this.paused, 1)
+	return true
+}
+
+func (this *workerControl) resume() bool {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+	if this.thrv == nil {
+		return false
+	}
+	atomic.StoreUint32(&this.paused, 0)
+	this.cond.Broadcast()
+	return true
+}
+
+// stop requests workers to stop, and the request remains pending until
+// the next run if workers are not running.
+func (this *workerControl) stop() bool {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+	atomic.StoreUint32(&this.paused, 0)
+	this.cond.Broadcast()
+	select {
+	case this.stopCh <- 1:
+	default:
+	}
+	return this.thrv != nil
+}
+
+// wait blocks the calling worker while paused. It's called per entry, so
+// the mutex is only taken when paused.
+func (this *workerControl) wait() {
+	if atomic.LoadUint32(&this.paused) == 0 {
+		return
+	}
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+	for this.paused != 0 {
+		this.cond.Wait()
+	}
+}
+
+func (this *workerControl) collectStat() []threadStat {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+	return collectStat(this.thrv)
+}
+
+// collectStat returns a snapshot of per thread stats.
+func collectStat(thrv []gThread) []threadStat {
+	// ignore possible race
+	var tsv []threadStat
+	for i := 0; i < len(thrv); i++ {
+		ts := thrv[i].stat
+		if thrv[i].numComplete+thrv[i].numInterrupted+thrv[i].numError == 0 {
+			ts.setTimeEnd()
+		}
+		tsv = append(tsv, ts)
+	}
+	return tsv
+}
+
 func newRead(gid uint, bufsiz uint) gThread {
 	return gThread{
 		gid:  gid,
+		rand: newWorkerRand(gid),
 		dir:  newReadDir(bufsiz),
 		stat: newReadStat(),
 	}
@@ -64,11 +197,51 @@ func newRead(gid uint, bufsiz uint) gThread {
 func newWrite(gid uint, bufsiz uint) gThread {
 	return gThread{
 		gid:  gid,
+		rand: newWorkerRand(gid),
 		dir:  newWriteDir(bufsiz),
 		stat: newWriteStat(),
 	}
 }
 
+// workerSeed is a seed of the current dispatch, each worker derives its own
+// source from this and gid, so that a run is reproducible with -seed.
+var workerSeed int64
+
+// initSeed sets a seed for i'th dispatch, which is -seed plus i if specified,
+// or current time otherwise.
+func initSeed(i uint) int64 {
+	if optSeed != 0 {
+		workerSeed = optSeed + int64(i)
+	} else {
+		workerSeed = time.Now().UnixNano()
+	}
+	rand.Seed(workerSeed)
+	return workerSeed
+}
+
+// getWorkerSeed mixes seed and gid with splitmix64, so that workers get
+// uncorrelated sources even with adjacent seeds.
+func getWorkerSeed(seed int64, gid uint) int64 {
+	x := uint64(seed) + uint64(gid+1)*0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return int64(x ^ (x >> 31))
+}
+
+func newWorkerRand(gid uint) *rand.Rand {
+	return rand.New(rand.NewSource(getWorkerSeed(workerSeed, gid)))
+}
+
+// setResult is a result of dispatchWorker in exported form.
+type setResult struct {
+	Seed           int64        `json:"seed"`
+	NumComplete    int          `json:"num_complete"`
+	NumInterrupted int          `json:"num_interrupted"`
+	NumError       int          `json:"num_error"`
+	NumRemain      int          `json:"num_remain"`
+	Stats          []threadStat `json:"stats"`
+}
+
 func setupFlistImpl(input []string) ([][]string, error) {
 	fls := make([][]string, len(input))
 	if len(optFlistFile) != 0 {
@@ -155,6 +328,7 @@ func dispatchWorker(input []string) (int, int, int, int, []threadStat, error) {
 	}
 	assert(optTimeMinute == 0)
 	assert(optMonitorIntMinute == 0)
+	keptWritePaths = nil
 
 	// number of readers and writers are 0 by default
 	if optNumReader == 0 && optNumWriter == 0 {
@@ -162,56 +336,92 @@ func dispatchWorker(input []string) (int, int, int, int, []threadStat, error) {
 	}
 
 	// initialize common variables among goroutines
-	signalCh := make(chan int)
+	// signalCh is sent without blocking, so that senders never block once
+	// the first one is received
+	signalCh := make(chan int, 1)
 	interruptCh := make(chan int)
+	notify := func() {
+		select {
+		case signalCh <- 1:
+		default:
+		}
+	}
 
 	var wg sync.WaitGroup
 	signaled := false
 
 	// initialize dir
-	initDir(optRandomWriteData)
+	if err := initDirect(input); err != nil {
+		return -1, -1, -1, -1, nil, err
+	}
+	initDir()
 
 	// initialize thread structure
-	numThread := optNumReader + optNumWriter
 	var thrv []gThread
-	for i := uint(0); i < numThread; i++ {
-		if i < optNumReader {
+	for i := uint(0); i < optNumReader+optNumWriter; i++ {
+		if !isProcessThread(i) {
+			continue // run by other process
+		} else if i < optNumReader {
 			thrv = append(thrv, newRead(i, optReadBufferSize))
 		} else {
 			thrv = append(thrv, newWrite(i, optWriteBufferSize))
 		}
 	}
-	assert(uint(len(thrv)) == numThread)
+	numThread := uint(len(thrv))
+	if numThread == 0 {
+		return 0, 0, 0, 0, nil, nil
+	}
 
 	// setup flist
 	fls, err := setupFlist(input)
 	if err != nil {
 		return -1, -1, -1, -1, nil, err
 	}
+
+	// open trace file if specified
+	if len(optTraceFile) != 0 {
+		if err := openTrace(); err != nil {
+			return -1, -1, -1, -1, nil, err
+		}
+		defer func() {
+			if err := closeTrace(); err != nil {
+				fmt.Println(err)
+			}
+		}()
+	}
 	if optPathIter == pathIterWalk {
 		assert(len(fls) == 0)
 	} else {
 		assert(len(fls) != 0)
 	}
 
+	// allow other goroutines to control workers
+	stopCh := workerCtl.begin(thrv)
+	defer workerCtl.end()
+
 	// signal handler goroutine
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		ch := make(chan os.Signal, 1)
 		signal.Notify(ch, syscall.SIGINT)
+		defer signal.Stop(ch)
 		label := "[signal]"
 		for {
 			select {
 			case <-interruptCh:
 				dbg(label, "interrupt")
 				return
+			case <-stopCh:
+				dbg(label, "stop")
+				signaled = true
+				notify()
 			case s := <-ch:
 				dbg("signal", s)
 				switch s {
 				case syscall.SIGINT:
 					signaled = true
-					signalCh <- 1
+					notify()
 				}
 			}
 		}
@@ -232,21 +442,24 @@ func dispatchWorker(input []string) (int, int, int, int, []threadStat, error) {
 					return
 				case <-timerCh:
 					dbg(label, "timer")
-					// ignore possible race
-					var tsv []threadStat
-					for i := 0; i < len(thrv); i++ {
-						if thrv[i].numComplete == 0 {
-							thrv[i].stat.setTimeEnd()
-						}
-						tsv = append(tsv, thrv[i].stat)
-					}
-					printStat(tsv)
+					printStat(collectStat(thrv))
 					timerCh = time.After(d)
 				}
 			}
 		}()
 	}
 
+	// syncfs goroutine
+	var syncfsLat latencyStat
+	if optSyncfsIntSecond > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d := time.Duration(optSyncfsIntSecond) * time.Second
+			syncfsLat = runSyncfs(input, d, interruptCh)
+		}()
+	}
+
 	// worker goroutines
 	for i := 0; i < len(thrv); i++ {
 		wg.Add(1)
@@ -254,6 +467,12 @@ func dispatchWorker(input []string) (int, int, int, int, []threadStat, error) {
 		thr.stat.setTimeBegin()
 		go func() {
 			defer wg.Done()
+			defer func() {
+				if err := finishEntry(thr); err != nil {
+					dbgf("#%d %s", thr.gid, err)
+					fmt.Println(err)
+				}
+			}()
 			defer func() {
 				// XXX possible race vs signal handler goroutine
 				total := uint(0)
@@ -267,7 +486,7 @@ func dispatchWorker(input []string) (int, int, int, int, []threadStat, error) {
 						dbgf("%d+%d goroutines done", total, 1)
 					} else {
 						dbgf("%d goroutines done", total)
-						signalCh <- 1
+						notify()
 					}
 				}
 				thr.stat.setTimeEnd()
@@ -301,15 +520,12 @@ func dispatchWorker(input []string) (int, int, int, int, []threadStat, error) {
 								dbgf("#%d timer", thr.gid)
 								return &workerTimer{}
 							default:
+								workerCtl.wait()
 								assert(strings.HasPrefix(f, inputPath))
 								if err != nil {
 									return err
 								}
-								if thr.isReader() {
-									return readEntry(f, thr)
-								} else {
-									return writeEntry(f, thr)
-								}
+								return processEntry(f, thr)
 							}
 						})
 				} else {
@@ -323,24 +539,23 @@ func dispatchWorker(input []string) (int, int, int, int, []threadStat, error) {
 							dbgf("#%d timer", thr.gid)
 							err = &workerTimer{}
 						default:
+							workerCtl.wait()
 							var idx int
-							switch optPathIter {
-							case pathIterOrdered:
+							switch {
+							case optPersonality != nil && optPersonality.index != nil:
+								idx = optPersonality.index(fl, thr)
+							case optPathIter == pathIterOrdered:
 								idx = i
-							case pathIterReverse:
+							case optPathIter == pathIterReverse:
 								idx = len(fl) - 1 - i
-							case pathIterRandom:
-								idx = rand.Intn(len(fl))
+							case optPathIter == pathIterRandom:
+								idx = thr.rand.Intn(len(fl))
 							default:
 								idx = -1
 							}
 							f := fl[idx]
 							assert(strings.HasPrefix(f, inputPath))
-							if thr.isReader() {
-								err = readEntry(f, thr)
-							} else {
-								err = writeEntry(f, thr)
-							}
+							err = processEntry(f, thr)
 						}
 						if err != nil {
 							break
@@ -384,9 +599,14 @@ func dispatchWorker(input []string) (int, int, int, int, []threadStat, error) {
 
 	<-signalCh
 	close(interruptCh)
+	workerCtl.resume() // wake up paused workers
 
 	wg.Wait()
 
+	// syncfs latency is not per thread, merge it into the first thread's
+	// so that it's carried along with thread stats
+	thrv[0].stat.mergeFlushLatency(flushSyncfs, &syncfsLat)
+
 	// collect result
 	numComplete := uint(0)
 	numInterrupted := uint(0)
@@ -404,9 +624,15 @@ func dispatchWorker(input []string) (int, int, int, int, []threadStat, error) {
 		tdv = append(tdv, &thrv[i].dir)
 		tsv = append(tsv, thrv[i].stat)
 	}
-	if numRemain, err := cleanupWritePaths(tdv, optKeepWritePaths); err != nil {
+	if isChildProcess() {
+		// leave write paths to parent process
+		keptWritePaths = getWritePaths(tdv)
+		return int(numComplete), int(numInterrupted), int(numError), 0, tsv, nil
+	}
+	if l, err := cleanupWritePaths(tdv, optKeepWritePaths); err != nil {
 		return -1, -1, -1, -1, nil, err
 	} else {
-		return int(numComplete), int(numInterrupted), int(numError), numRemain, tsv, nil
+		keptWritePaths = l
+		return int(numComplete), int(numInterrupted), int(numError), len(l), tsv, nil
 	}
 }
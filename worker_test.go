@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func Test_getWorkerSeed(t *testing.T) {
+	seedList := []int64{0, 1, 2, -1, 1 << 62}
+	m := make(map[int64]bool)
+	for _, seed := range seedList {
+		for gid := uint(0); gid < 8; gid++ {
+			x := getWorkerSeed(seed, gid)
+			if x != getWorkerSeed(seed, gid) {
+				t.Error(seed, gid, x)
+			}
+			if m[x] {
+				t.Error(seed, gid, x)
+			}
+			m[x] = true
+		}
+	}
+}
+
+func Test_newWorkerRand(t *testing.T) {
+	optSeed = 12345
+	defer func() {
+		optSeed = 0
+	}()
+
+	var v [2][]int
+	for i := range v {
+		initSeed(0)
+		r := newWorkerRand(1)
+		for j := 0; j < 16; j++ {
+			v[i] = append(v[i], r.Intn(1<<30))
+		}
+	}
+	for j := range v[0] {
+		if v[0][j] != v[1][j] {
+			t.Error(j, v[0][j], v[1][j])
+		}
+	}
+
+	if seed := initSeed(3); seed != optSeed+3 {
+		t.Error(seed)
+	}
+}
+
+func Test_workerControl(t *testing.T) {
+	this := newWorkerControl()
+	if this.stop() {
+		t.Error("not running")
+	}
+	stopCh := this.begin(make([]gThread, 1))
+	select {
+	case <-stopCh:
+	default:
+		t.Error("stop not pending")
+	}
+
+	// stop after interrupted is dropped at the end of the run
+	if !this.stop() {
+		t.Error("running")
+	}
+	this.end()
+	stopCh = this.begin(make([]gThread, 1))
+	select {
+	case <-stopCh:
+		t.Error("stop pending")
+	default:
+	}
+	this.end()
+}
+
+// Benchmark_readFileWorkers shows how throughput of random file selection
+// and random read size scales with number of workers, ns/op is per file
+// among all workers.
+func Benchmark_readFileWorkers(b *testing.B) {
+	d := b.TempDir()
+	var fl []string
+	for i := 0; i < 64; i++ {
+		f := filepath.Join(d, fmt.Sprint(i))
+		if err := os.WriteFile(f, make([]byte, 1<<12), 0644); err != nil {
+			b.Fatal(err)
+		}
+		fl = append(fl, f)
+	}
+
+	readSize := optReadSize
+	optReadSize, _ = parseResidSize("0", 1<<12) // random size
+	defer func() {
+		optReadSize = readSize
+	}()
+
+	for _, n := range []int{1, 2, 4, 8, 16, 32, 64} {
+		b.Run(fmt.Sprintf("workers=%d", n), func(b *testing.B) {
+			thrv := make([]gThread, n)
+			for i := range thrv {
+				thrv[i] = newRead(uint(i), 1<<12)
+			}
+			b.ResetTimer()
+			var wg sync.WaitGroup
+			for i := range thrv {
+				wg.Add(1)
+				thr := &thrv[i]
+				go func() {
+					defer wg.Done()
+					for j := thr.gid; j < uint(b.N); j += uint(n) {
+						if err := readFile(fl[thr.rand.Intn(len(fl))], thr); err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}